@@ -22,11 +22,56 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+const (
+	// ReasonAnnotation is the annotation used to record the reason for an accessrequest on the
+	// bindings created for it
+	ReasonAnnotation = "iam.dippynark.co.uk/reason"
+	// TicketAnnotation is the annotation used to record the ticket referenced by an accessrequest on
+	// the bindings created for it
+	TicketAnnotation = "iam.dippynark.co.uk/ticket"
+	// ContextAnnotationPrefix is the prefix of the annotations used to record the context of an
+	// accessrequest on the bindings created for it
+	ContextAnnotationPrefix = "context.iam.dippynark.co.uk/"
+	// AccessRequestUIDLabel is the label used to record the UID of the accessrequest that bindings
+	// were created for
+	AccessRequestUIDLabel = "iam.dippynark.co.uk/accessrequest-uid"
+	// AccessRequestAnnotation is the annotation used to record the namespace and name of the
+	// accessrequest that bindings were created for, in the form <namespace>/<name>
+	AccessRequestAnnotation = "iam.dippynark.co.uk/accessrequest"
+
+	// RequestableLabel marks Roles and ClusterRoles that can be requested when set to true so that
+	// they are listed in the catalog
+	RequestableLabel = "iam.dippynark.co.uk/requestable"
+	// DescriptionAnnotation describes a requestable role in the catalog
+	DescriptionAnnotation = "iam.dippynark.co.uk/description"
+	// OwnerAnnotation records the team that owns a requestable role
+	OwnerAnnotation = "iam.dippynark.co.uk/owner"
+	// MaxDurationAnnotation limits the duration of accessrequests for a requestable role, for example
+	// 8h. Accessrequests referencing the role must set a duration no longer than this
+	MaxDurationAnnotation = "iam.dippynark.co.uk/max-duration"
+	// ApproverGroupAnnotation records the group whose members approve accessrequests for a
+	// requestable role
+	ApproverGroupAnnotation = "iam.dippynark.co.uk/approver-group"
+)
+
 // AccessRequestSpec defines the desired state of AccessRequest
 type AccessRequestSpec struct {
-	// Approved specifies whether the accessrequest has been approved
+	// Approved specifies whether the accessrequest has been approved. Approvers set this field to
+	// approve the accessrequest and the mutating webhook records their approval, only leaving it set
+	// once the required number of approvals has been reached
 	Approved bool `json:"approved,omitempty"`
 
+	// RequiredApprovals is the number of distinct approvers that must approve the accessrequest.
+	// Defaults to 1
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	RequiredApprovals *int32 `json:"requiredApprovals,omitempty"`
+
+	// Template references the accessrequesttemplate that the mutating webhook expands into the roles,
+	// rules, namespaces, duration and required approvals of the accessrequest when it is created
+	// +optional
+	Template *TemplateReference `json:"template,omitempty"`
+
 	// Attributes holds contextual information about the accessrequest. The mutating webhook requires
 	// this field to be a pointer otherwise it cannot decide whether to patch an empty object when
 	// patching attributes
@@ -37,16 +82,164 @@ type AccessRequestSpec struct {
 	Subjects []rbacv1.Subject `json:"subjects,omitempty"`
 
 	// RoleRef can reference a Role in the current namespace or a ClusterRole in the global namespace.
-	RoleRef rbacv1.RoleRef `json:"roleRef"`
+	// One of roleRef, roleRefs or rules must be set
+	// +optional
+	RoleRef rbacv1.RoleRef `json:"roleRef,omitempty"`
+
+	// RoleRefs references several roles that are approved together and bound in the same way as
+	// roleRef. A rolebinding is created for each role
+	// +optional
+	RoleRefs []rbacv1.RoleRef `json:"roleRefs,omitempty"`
+
+	// Rules are granted through a role created for the accessrequest, so that access can be requested
+	// without an existing role. The role is created when the accessrequest is granted and deleted
+	// when access is revoked
+	// +optional
+	Rules []rbacv1.PolicyRule `json:"rules,omitempty"`
+
+	// Namespaces lists the namespaces that access is granted in. If neither namespaces nor
+	// namespaceSelector are set, access is granted in the namespace of the accessrequest
+	// +optional
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// NamespaceSelector selects the namespaces that access is granted in, in addition to those
+	// listed in namespaces. Access is also granted in matching namespaces created while the
+	// accessrequest is active
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// Reason explains why access is required. The validating webhook requires this field to be set
+	// when the accessrequest is created
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Ticket references an external ticket or incident that the accessrequest relates to
+	// +optional
+	Ticket string `json:"ticket,omitempty"`
+
+	// Context holds free-form labels describing the accessrequest, such as the affected service or
+	// environment
+	// +optional
+	Context map[string]string `json:"context,omitempty"`
+
+	// Duration specifies how long access is granted for once the corresponding binding has been
+	// created. If unset, access is granted until the accessrequest is deleted
+	// +optional
+	Duration *metav1.Duration `json:"duration,omitempty"`
+
+	// StartTime specifies when access is granted from. An approved accessrequest is not activated
+	// before its start time. Break-glass accessrequests are activated immediately so cannot set it
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// TTLSecondsAfterFinished limits the lifetime of an accessrequest that has finished, meaning that
+	// access granted by it is no longer active. Once the accessrequest has been finished for this
+	// many seconds it is deleted. If unset, the controller-wide default is used
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	TTLSecondsAfterFinished *int32 `json:"ttlSecondsAfterFinished,omitempty"`
+
+	// Extensions request additional time for a time-bound accessrequest that is granting access.
+	// Each extension must be approved in the same way as the accessrequest before access is extended
+	// +optional
+	Extensions []Extension `json:"extensions,omitempty"`
+
+	// BreakGlass requests emergency access. A break-glass accessrequest is activated immediately
+	// without waiting for approval and must then be reviewed by an approver before its review
+	// deadline
+	// +optional
+	BreakGlass *BreakGlass `json:"breakGlass,omitempty"`
+}
+
+// TemplateReference references an accessrequesttemplate
+type TemplateReference struct {
+	// Name of the accessrequesttemplate
+	Name string `json:"name"`
+
+	// Parameters holds the values of the parameters of the accessrequesttemplate
+	// +optional
+	Parameters map[string]string `json:"parameters,omitempty"`
+}
+
+type BreakGlass struct {
+	// Justification explains why emergency access is required
+	Justification string `json:"justification"`
 }
 
 type Attributes struct {
 	// Signifies who created the accessrequest
 	CreatedBy string `json:"createdBy,omitempty"`
 
+	// CreatedByUserInfo records the groups and other attributes of the user who created the
+	// accessrequest so that their access can be verified again by the controller
+	// +optional
+	CreatedByUserInfo *UserInfo `json:"createdByUserInfo,omitempty"`
+
 	// Signifies who approved the accessrequest
 	// +optional
 	ApprovedBy string `json:"approvedBy,omitempty"`
+
+	// Approvals records each approver of the accessrequest
+	// +optional
+	Approvals []Approval `json:"approvals,omitempty"`
+}
+
+// UserInfo records the attributes of an authenticated user other than their username. These are
+// recorded by the mutating webhook so that access granted to the user through their groups can be
+// verified with subjectaccessreviews outside of admission
+type UserInfo struct {
+	// UID identifies the user across time
+	// +optional
+	UID string `json:"uid,omitempty"`
+
+	// Groups the user belongs to
+	// +optional
+	Groups []string `json:"groups,omitempty"`
+
+	// Extra holds additional information provided by the authenticator
+	// +optional
+	Extra map[string][]string `json:"extra,omitempty"`
+}
+
+// Approval records an approval of an accessrequest
+type Approval struct {
+	// User who approved the accessrequest
+	User string `json:"user"`
+
+	// UserInfo records the groups and other attributes of the user who approved the accessrequest
+	// so that approval granted to their groups can be verified again by the controller
+	// +optional
+	UserInfo *UserInfo `json:"userInfo,omitempty"`
+
+	// Time at which the accessrequest was approved
+	Time metav1.Time `json:"time"`
+
+	// Delegator is the approver on whose behalf the user approved the accessrequest through an
+	// approverdelegation. If unset, the user approved with their own approval rights
+	// +optional
+	Delegator string `json:"delegator,omitempty"`
+}
+
+// Extension requests additional time for an accessrequest
+type Extension struct {
+	// Reason explains why more time is needed
+	Reason string `json:"reason"`
+
+	// Duration is the additional time requested
+	Duration metav1.Duration `json:"duration"`
+
+	// Approved is set by approvers to approve the extension. Like the accessrequest, the extension
+	// remains unapproved until it has enough approvals
+	// +optional
+	Approved bool `json:"approved,omitempty"`
+
+	// RequestedBy records who requested the extension. This is set by the mutating webhook
+	// +optional
+	RequestedBy string `json:"requestedBy,omitempty"`
+
+	// Approvals records each approval of the extension. These are recorded by the mutating webhook
+	// +optional
+	Approvals []Approval `json:"approvals,omitempty"`
 }
 
 // AccessRequestStatus defines the observed state of AccessRequest
@@ -56,6 +249,45 @@ type AccessRequestStatus struct {
 	// +optional
 	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
 
+	// Represents time when access granted by the accessrequest expires. The expiration time is only
+	// set when the corresponding binding has been created and the accessrequest is time-bound.
+	// +optional
+	ExpirationTime *metav1.Time `json:"expirationTime,omitempty"`
+
+	// Represents time by which a break-glass accessrequest must be reviewed by an approver.
+	// +optional
+	ReviewDeadline *metav1.Time `json:"reviewDeadline,omitempty"`
+
+	// Represents time when the accessrequest was archived. The accessrequest is archived once it
+	// finishes if the controller has been configured with an archive.
+	// +optional
+	ArchiveTime *metav1.Time `json:"archiveTime,omitempty"`
+
+	// RoleBindings describes the rolebindings created for each role referenced by the accessrequest
+	// +optional
+	RoleBindings []RoleBindingStatus `json:"roleBindings,omitempty"`
+
+	// Risk describes the permissions granted by the roles and rules of the accessrequest so that
+	// approvers and policies can assess them
+	// +optional
+	Risk *RiskStatus `json:"risk,omitempty"`
+
+	// Escalations records each time the accessrequest was escalated to another approver group
+	// because it had not been approved in time
+	// +optional
+	Escalations []Escalation `json:"escalations,omitempty"`
+
+	// ApprovedRoles records the rules of each role referenced by the accessrequest when it was
+	// approved so that access can be suspended if a role is later changed to grant more
+	// +optional
+	ApprovedRoles []ApprovedRole `json:"approvedRoles,omitempty"`
+
+	// Represents time when the rules of the referenced roles were recorded in approvedRoles. Roles
+	// created, or namespaces selected, after this time were not approved so access is suspended
+	// while they exist.
+	// +optional
+	ApprovedRolesTime *metav1.Time `json:"approvedRolesTime,omitempty"`
+
 	// The latest available observations of an object's current state.
 	// +optional
 	// +patchMergeKey=type
@@ -63,6 +295,68 @@ type AccessRequestStatus struct {
 	Conditions []AccessRequestCondition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
 }
 
+// RiskStatus describes the permissions granted by an accessrequest
+type RiskStatus struct {
+	// Score rates the risk of the granted permissions from 0, for no risky privileges, to 100
+	Score int32 `json:"score"`
+
+	// Risks lists the risky privileges granted, such as Secrets or Impersonate
+	// +optional
+	Risks []string `json:"risks,omitempty"`
+
+	// Summary describes each rule granted by each role, for example
+	// "ClusterRole pod-reader: get, list on pods"
+	// +optional
+	Summary []string `json:"summary,omitempty"`
+}
+
+// Escalation records the escalation of a pending accessrequest to an approver group
+type Escalation struct {
+	// Group of approvers that the accessrequest was escalated to
+	Group string `json:"group"`
+
+	// Time at which the accessrequest was escalated
+	Time metav1.Time `json:"time"`
+}
+
+// ApprovedRole records the rules granted by a role referenced by an accessrequest when it was
+// approved
+type ApprovedRole struct {
+	// Namespace of the role, empty for clusterroles
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// RoleRef references the role
+	RoleRef rbacv1.RoleRef `json:"roleRef"`
+
+	// Hash of the approved rules
+	Hash string `json:"hash"`
+
+	// Rules granted by the role when the accessrequest was approved
+	// +optional
+	Rules []rbacv1.PolicyRule `json:"rules,omitempty"`
+}
+
+// RoleBindingStatus describes the rolebinding created for a role referenced by an accessrequest in
+// one of its namespaces
+type RoleBindingStatus struct {
+	// Name of the rolebinding
+	Name string `json:"name"`
+
+	// Namespace of the rolebinding
+	Namespace string `json:"namespace"`
+
+	// RoleRef references the role bound by the rolebinding
+	RoleRef rbacv1.RoleRef `json:"roleRef"`
+
+	// Bound specifies whether the rolebinding has been created and grants access
+	Bound bool `json:"bound"`
+
+	// Human readable message indicating why the rolebinding is not bound
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 
@@ -92,10 +386,21 @@ const (
 	AccessRequestApproved AccessRequestConditionType = "Approved"
 	// AccessRequestComplete means the accessrequest has completed its lifecycle.
 	AccessRequestComplete AccessRequestConditionType = "Complete"
+	// AccessRequestExpired means access granted by the accessrequest has expired.
+	AccessRequestExpired AccessRequestConditionType = "Expired"
+	// AccessRequestReviewed means a break-glass accessrequest has been reviewed by an approver.
+	AccessRequestReviewed AccessRequestConditionType = "Reviewed"
+	// AccessRequestRoleChanged means a role referenced by the accessrequest has been changed to
+	// grant more than was approved.
+	AccessRequestRoleChanged AccessRequestConditionType = "RoleChanged"
+	// AccessRequestRejected means the accessrequest was closed without granting access because its
+	// approval was not allowed or expired.
+	AccessRequestRejected AccessRequestConditionType = "Rejected"
 )
 
 type AccessRequestCondition struct {
-	// Type of accessrequest condition, Approved or Complete.
+	// Type of accessrequest condition, Approved, Complete, Expired, Reviewed, RoleChanged or
+	// Rejected.
 	Type AccessRequestConditionType `json:"type"`
 	// Status of the condition, one of True, False, Unknown.
 	Status v1.ConditionStatus `json:"status"`
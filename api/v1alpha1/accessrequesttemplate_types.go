@@ -0,0 +1,104 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AccessRequestTemplateSpec defines the access that accessrequests referencing the template request.
+// Parameters are substituted into the role reference names, the resource names of the rules, the
+// namespaces and the namespace selector labels wherever $(name) appears
+type AccessRequestTemplateSpec struct {
+	// Description explains what access the template grants and when it should be requested
+	// +optional
+	Description string `json:"description,omitempty"`
+
+	// RoleRefs references the roles granted by the template
+	// +optional
+	RoleRefs []rbacv1.RoleRef `json:"roleRefs,omitempty"`
+
+	// Rules are granted through a role created for each accessrequest referencing the template
+	// +optional
+	Rules []rbacv1.PolicyRule `json:"rules,omitempty"`
+
+	// Namespaces lists the namespaces that access is granted in. If neither namespaces nor
+	// namespaceSelector are set, access is granted in the namespace of the accessrequest
+	// +optional
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// NamespaceSelector selects the namespaces that access is granted in
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// Duration is the default duration of accessrequests referencing the template
+	// +optional
+	Duration *metav1.Duration `json:"duration,omitempty"`
+
+	// RequiredApprovals is the number of distinct approvers that must approve accessrequests
+	// referencing the template. Defaults to 1
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	RequiredApprovals *int32 `json:"requiredApprovals,omitempty"`
+
+	// Parameters are the values that accessrequests referencing the template provide
+	// +optional
+	Parameters []TemplateParameter `json:"parameters,omitempty"`
+}
+
+// TemplateParameter is a value provided by accessrequests referencing a template
+type TemplateParameter struct {
+	// Name of the parameter, referenced in the template as $(name)
+	Name string `json:"name"`
+
+	// Description of the parameter
+	// +optional
+	Description string `json:"description,omitempty"`
+
+	// Required specifies whether accessrequests must provide the parameter
+	// +optional
+	Required bool `json:"required,omitempty"`
+
+	// Default is the value used if an accessrequest does not provide the parameter
+	// +optional
+	Default string `json:"default,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+
+// AccessRequestTemplate is the Schema for the accessrequesttemplates API
+type AccessRequestTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec AccessRequestTemplateSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// AccessRequestTemplateList contains a list of AccessRequestTemplate
+type AccessRequestTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AccessRequestTemplate `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&AccessRequestTemplate{}, &AccessRequestTemplateList{})
+}
@@ -0,0 +1,67 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ApproverDelegationSpec delegates the approval rights of an approver to another user for a bounded
+// time window
+type ApproverDelegationSpec struct {
+	// Delegator is the approver delegating their approval rights. It must be the user creating the
+	// delegation
+	Delegator string `json:"delegator"`
+
+	// Delegate is the user who may approve accessrequests on behalf of the delegator
+	Delegate string `json:"delegate"`
+
+	// StartTime is when the delegation starts. If unset, it starts when it is created
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// EndTime is when the delegation ends
+	EndTime metav1.Time `json:"endTime"`
+
+	// Reason explains why approval rights are delegated, for example annual leave
+	// +optional
+	Reason string `json:"reason,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+
+// ApproverDelegation is the Schema for the approverdelegations API
+type ApproverDelegation struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ApproverDelegationSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ApproverDelegationList contains a list of ApproverDelegation
+type ApproverDelegationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ApproverDelegation `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ApproverDelegation{}, &ApproverDelegationList{})
+}
@@ -0,0 +1,237 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// RoleBindingName returns the name of the rolebinding created for the accessrequest that binds the
+// given role in the given namespace. Names are derived from the UID of the accessrequest so that
+// they are deterministic but do not collide with existing rolebindings or with each other
+func RoleBindingName(accessRequest *AccessRequest, namespace string, roleRef rbacv1.RoleRef) string {
+	return nameWithHash(accessRequest.Name, fmt.Sprintf("%s/%s/%s/%s", accessRequest.UID, namespace, roleRef.Kind, roleRef.Name))
+}
+
+// InlineRoleRef returns the reference to the role created for the rules of the accessrequest. The
+// role has the same name in every namespace that access is granted in
+func InlineRoleRef(accessRequest *AccessRequest) rbacv1.RoleRef {
+	return rbacv1.RoleRef{
+		APIGroup: rbacv1.GroupName,
+		Kind:     "Role",
+		Name:     nameWithHash(accessRequest.Name, fmt.Sprintf("%s/rules", accessRequest.UID)),
+	}
+}
+
+// RoleRefs returns the roles referenced by the accessrequest through roleRef and roleRefs, without
+// duplicates, followed by the role created for its rules
+func RoleRefs(accessRequest *AccessRequest) []rbacv1.RoleRef {
+	roleRefs := []rbacv1.RoleRef{}
+	seen := map[rbacv1.RoleRef]bool{}
+	for _, roleRef := range append([]rbacv1.RoleRef{accessRequest.Spec.RoleRef}, accessRequest.Spec.RoleRefs...) {
+		if roleRef.Name == "" || seen[roleRef] {
+			continue
+		}
+		seen[roleRef] = true
+		roleRefs = append(roleRefs, roleRef)
+	}
+	if len(accessRequest.Spec.Rules) > 0 {
+		roleRefs = append(roleRefs, InlineRoleRef(accessRequest))
+	}
+	return roleRefs
+}
+
+// nameWithHash returns the given name suffixed with a hash of the given key, truncating the name so
+// that the result is a valid object name
+func nameWithHash(name, key string) string {
+	hasher := fnv.New32a()
+	fmt.Fprint(hasher, key)
+	suffix := rand.SafeEncodeString(fmt.Sprint(hasher.Sum32()))
+
+	if maxLength := validation.DNS1123SubdomainMaxLength - len(suffix) - 1; len(name) > maxLength {
+		name = strings.TrimRight(name[:maxLength], ".-")
+	}
+	return fmt.Sprintf("%s-%s", name, suffix)
+}
+
+// TargetNamespaces returns the namespaces, out of the given existing namespaces, that the
+// accessrequest grants access in, and the namespaces it lists that do not exist
+func TargetNamespaces(accessRequest *AccessRequest, namespaces []corev1.Namespace) ([]string, []string, error) {
+	if len(accessRequest.Spec.Namespaces) == 0 && accessRequest.Spec.NamespaceSelector == nil {
+		return []string{accessRequest.Namespace}, nil, nil
+	}
+
+	var selector labels.Selector
+	if accessRequest.Spec.NamespaceSelector != nil {
+		var err error
+		selector, err = metav1.LabelSelectorAsSelector(accessRequest.Spec.NamespaceSelector)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	listed := map[string]bool{}
+	for _, namespace := range accessRequest.Spec.Namespaces {
+		listed[namespace] = true
+	}
+
+	targets := []string{}
+	for _, namespace := range namespaces {
+		// Access is not granted in namespaces that are being deleted
+		if namespace.Status.Phase == corev1.NamespaceTerminating {
+			delete(listed, namespace.Name)
+			continue
+		}
+		if listed[namespace.Name] || (selector != nil && selector.Matches(labels.Set(namespace.Labels))) {
+			targets = append(targets, namespace.Name)
+		}
+		delete(listed, namespace.Name)
+	}
+
+	missing := []string{}
+	for _, namespace := range accessRequest.Spec.Namespaces {
+		if listed[namespace] {
+			missing = append(missing, namespace)
+			delete(listed, namespace)
+		}
+	}
+
+	return targets, missing, nil
+}
+
+// RequiredApprovals returns the number of distinct approvers that must approve the accessrequest
+func RequiredApprovals(accessRequest *AccessRequest) int {
+	if accessRequest.Spec.RequiredApprovals == nil || *accessRequest.Spec.RequiredApprovals < 1 {
+		return 1
+	}
+	return int(*accessRequest.Spec.RequiredApprovals)
+}
+
+// Approvals returns the approvals of the accessrequest, one for each distinct approver.
+// Accessrequests approved before approvals were recorded are approved by the approvedBy attribute
+// alone
+func Approvals(accessRequest *AccessRequest) []Approval {
+	if accessRequest.Spec.Attributes == nil {
+		return nil
+	}
+	approvals := distinctApprovals(accessRequest.Spec.Attributes.Approvals)
+	if len(approvals) == 0 && accessRequest.Spec.Attributes.ApprovedBy != "" {
+		approvals = append(approvals, Approval{User: accessRequest.Spec.Attributes.ApprovedBy})
+	}
+	return approvals
+}
+
+// Approvers returns the users who approved the accessrequest, one for each distinct approver
+func Approvers(accessRequest *AccessRequest) []string {
+	approvers := []string{}
+	for _, approval := range Approvals(accessRequest) {
+		approvers = append(approvers, approval.User)
+	}
+	return approvers
+}
+
+// ExtensionApprovals returns the approvals of the extension, one for each distinct approver
+func ExtensionApprovals(extension *Extension) []Approval {
+	return distinctApprovals(extension.Approvals)
+}
+
+// Approver returns the approver that the approval counts for: the delegator if the approval was
+// made on their behalf and otherwise the user who made it
+func Approver(approval Approval) string {
+	if approval.Delegator != "" {
+		return approval.Delegator
+	}
+	return approval.User
+}
+
+// ApprovedByRequester returns whether the approval was made by, or on behalf of, the user who
+// created the accessrequest
+func ApprovedByRequester(accessRequest *AccessRequest, approval Approval) bool {
+	if accessRequest.Spec.Attributes == nil || accessRequest.Spec.Attributes.CreatedBy == "" {
+		return false
+	}
+	createdBy := accessRequest.Spec.Attributes.CreatedBy
+	return approval.User == createdBy || Approver(approval) == createdBy
+}
+
+// ApproverUserInfo returns the recorded attributes of the approver that the approval counts for, if
+// any. Only the attributes of the user who made the approval are recorded, so approvals made on
+// behalf of a delegator are verified against the delegator's own bindings
+func ApproverUserInfo(approval Approval) *UserInfo {
+	if approval.Delegator != "" {
+		return nil
+	}
+	return approval.UserInfo
+}
+
+// distinctApprovals returns the first of the given approvals for each approver
+func distinctApprovals(approvals []Approval) []Approval {
+	distinct := []Approval{}
+	seen := map[string]bool{}
+	for _, approval := range approvals {
+		if !seen[Approver(approval)] {
+			seen[Approver(approval)] = true
+			distinct = append(distinct, approval)
+		}
+	}
+	return distinct
+}
+
+// NewUserInfo returns the attributes of the given authenticated user to record on an accessrequest
+func NewUserInfo(userInfo authenticationv1.UserInfo) *UserInfo {
+	var extra map[string][]string
+	if len(userInfo.Extra) > 0 {
+		extra = map[string][]string{}
+		for key, value := range userInfo.Extra {
+			extra[key] = append([]string{}, value...)
+		}
+	}
+	return &UserInfo{
+		UID:    userInfo.UID,
+		Groups: append([]string(nil), userInfo.Groups...),
+		Extra:  extra,
+	}
+}
+
+// SubjectAccessReviewSpec returns the spec of a subjectaccessreview for the given user with the
+// given recorded attributes, if any
+func SubjectAccessReviewSpec(user string, userInfo *UserInfo) authv1.SubjectAccessReviewSpec {
+	spec := authv1.SubjectAccessReviewSpec{User: user}
+	if userInfo == nil {
+		return spec
+	}
+	spec.UID = userInfo.UID
+	spec.Groups = userInfo.Groups
+	if len(userInfo.Extra) > 0 {
+		spec.Extra = map[string]authv1.ExtraValue{}
+		for key, value := range userInfo.Extra {
+			spec.Extra[key] = authv1.ExtraValue(value)
+		}
+	}
+	return spec
+}
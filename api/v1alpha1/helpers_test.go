@@ -0,0 +1,128 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestTargetNamespaces(t *testing.T) {
+	namespace := func(name string, labels map[string]string) corev1.Namespace {
+		return corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+	}
+	terminating := namespace("retired", map[string]string{"team": "payments"})
+	terminating.Status.Phase = corev1.NamespaceTerminating
+
+	namespaces := []corev1.Namespace{
+		namespace("checkout", map[string]string{"team": "payments"}),
+		namespace("billing", map[string]string{"team": "payments"}),
+		namespace("monitoring", map[string]string{"team": "platform"}),
+		terminating,
+	}
+
+	tests := []struct {
+		name        string
+		spec        AccessRequestSpec
+		wantTargets []string
+		wantMissing []string
+		wantErr     bool
+	}{
+		{
+			name:        "defaults to the accessrequest namespace",
+			spec:        AccessRequestSpec{},
+			wantTargets: []string{"default"},
+			wantMissing: nil,
+		},
+		{
+			name:        "listed namespaces",
+			spec:        AccessRequestSpec{Namespaces: []string{"monitoring", "checkout"}},
+			wantTargets: []string{"checkout", "monitoring"},
+			wantMissing: []string{},
+		},
+		{
+			name:        "missing namespaces",
+			spec:        AccessRequestSpec{Namespaces: []string{"checkout", "unknown", "absent"}},
+			wantTargets: []string{"checkout"},
+			wantMissing: []string{"unknown", "absent"},
+		},
+		{
+			name:        "duplicate listed namespaces",
+			spec:        AccessRequestSpec{Namespaces: []string{"checkout", "checkout", "unknown", "unknown"}},
+			wantTargets: []string{"checkout"},
+			wantMissing: []string{"unknown"},
+		},
+		{
+			name:        "terminating namespaces are neither targets nor missing",
+			spec:        AccessRequestSpec{Namespaces: []string{"retired", "billing"}},
+			wantTargets: []string{"billing"},
+			wantMissing: []string{},
+		},
+		{
+			name:        "namespace selector",
+			spec:        AccessRequestSpec{NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "payments"}}},
+			wantTargets: []string{"checkout", "billing"},
+			wantMissing: []string{},
+		},
+		{
+			name:        "empty namespace selector selects every namespace",
+			spec:        AccessRequestSpec{NamespaceSelector: &metav1.LabelSelector{}},
+			wantTargets: []string{"checkout", "billing", "monitoring"},
+			wantMissing: []string{},
+		},
+		{
+			name: "listed and selected namespaces are combined",
+			spec: AccessRequestSpec{
+				Namespaces:        []string{"monitoring", "checkout", "unknown"},
+				NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "payments"}},
+			},
+			wantTargets: []string{"checkout", "billing", "monitoring"},
+			wantMissing: []string{"unknown"},
+		},
+		{
+			name: "invalid namespace selector",
+			spec: AccessRequestSpec{NamespaceSelector: &metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "team", Operator: "Matches"}},
+			}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			accessRequest := &AccessRequest{
+				ObjectMeta: metav1.ObjectMeta{Name: "debug", Namespace: "default"},
+				Spec:       tt.spec,
+			}
+			targets, missing, err := TargetNamespaces(accessRequest, namespaces)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TargetNamespaces() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(targets, tt.wantTargets) {
+				t.Errorf("TargetNamespaces() targets = %v, want %v", targets, tt.wantTargets)
+			}
+			if !reflect.DeepEqual(missing, tt.wantMissing) {
+				t.Errorf("TargetNamespaces() missing = %v, want %v", missing, tt.wantMissing)
+			}
+		})
+	}
+}
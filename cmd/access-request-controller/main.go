@@ -19,20 +19,29 @@ package main
 import (
 	"flag"
 	"os"
+	"path/filepath"
+	"regexp"
+	"time"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	crwebhook "sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	iamv1alpha1 "github.com/dippynark/access-request-controller/api/v1alpha1"
 	"github.com/dippynark/access-request-controller/controllers"
+	"github.com/dippynark/access-request-controller/pkg/archive"
+	"github.com/dippynark/access-request-controller/pkg/catalog"
+	"github.com/dippynark/access-request-controller/pkg/webhook"
 	// +kubebuilder:scaffold:imports
 )
 
 const (
 	leaderElectionID = "accessrequests.iam.dippynark.co.uk"
+
+	defaultControllerUsername = "system:serviceaccount:access-request-controller-system:default"
 )
 
 var (
@@ -50,18 +59,69 @@ func init() {
 func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
+	var breakGlassMaxDuration time.Duration
+	var reviewPeriod time.Duration
+	var reviewReminderInterval time.Duration
+	var ttlSecondsAfterFinished int
+	var pendingTTL time.Duration
+	var approvalValidity time.Duration
+	var escalationTiers string
+	var archiveSink string
+	var enableWebhook bool
+	var webhookCertDir string
+	var ticketPattern string
+	var controllerUsername string
+	var maxDelegationDuration time.Duration
+	var catalogPort int
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.DurationVar(&breakGlassMaxDuration, "break-glass-max-duration", time.Hour, "The maximum duration that a break-glass AccessRequest can grant access for.")
+	flag.DurationVar(&reviewPeriod, "review-period", 24*time.Hour, "The period after activation within which a break-glass AccessRequest must be reviewed by an approver.")
+	flag.DurationVar(&reviewReminderInterval, "review-reminder-interval", time.Hour, "The interval at which overdue break-glass AccessRequest reviews are escalated.")
+	flag.IntVar(&ttlSecondsAfterFinished, "ttl-seconds-after-finished", -1, "The default number of seconds after an AccessRequest finishes that it is deleted. A negative value disables deletion unless set by the AccessRequest.")
+	flag.DurationVar(&pendingTTL, "pending-ttl", 0, "The period after creation within which an AccessRequest must be approved before it is closed. Zero disables the time limit.")
+	flag.DurationVar(&approvalValidity, "approval-validity", 0, "The period after approval within which an AccessRequest must be activated before it must be approved again. Zero disables approval expiry.")
+	flag.StringVar(&escalationTiers, "escalation-tiers", "", "Comma-separated tiers of the form <duration>=<group>, for example 30m=team-leads,2h=platform-admins, escalating AccessRequests that have not been approved within the duration of their creation to the group. Each group must already be allowed to approve AccessRequests.")
+	flag.StringVar(&archiveSink, "archive-sink", "", "URL of the sink that records of finished AccessRequests are archived to, for example file:///var/lib/access-request-controller/archive.jsonl, https://collector.example.com/accessrequests or s3://bucket/prefix?endpoint=https://s3.example.com&region=us-east-1.")
+	flag.BoolVar(&enableWebhook, "enable-webhook", false, "Serve the AccessRequest admission webhooks from the controller manager instead of the standalone webhook.")
+	flag.IntVar(&catalogPort, "catalog-port", 0, "Secure port that the role catalog API is served on to the apiserver's aggregation layer, using the certificate in --webhook-cert-dir. If 0, the catalog is not served.")
+	flag.StringVar(&webhookCertDir, "webhook-cert-dir", "", "Directory containing the webhook serving certificate and key, named tls.crt and tls.key. Requires --enable-webhook.")
+	flag.StringVar(&ticketPattern, "ticket-pattern", "", "Regular expression that AccessRequest tickets must match. If set, AccessRequests must reference a ticket. Requires --enable-webhook.")
+	flag.StringVar(&controllerUsername, "controller-username", defaultControllerUsername, "Username of the controller's service account, which is the only user allowed to change RoleBindings controlled by AccessRequests. Requires --enable-webhook.")
+	flag.DurationVar(&maxDelegationDuration, "max-delegation-duration", 0, "The longest time window that an ApproverDelegation may cover. Zero disables the limit. Requires --enable-webhook.")
 	flag.Parse()
 
+	var defaultTTLSecondsAfterFinished *int32
+	if ttlSecondsAfterFinished >= 0 {
+		ttl := int32(ttlSecondsAfterFinished)
+		defaultTTLSecondsAfterFinished = &ttl
+	}
+
 	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
 
+	tiers, err := controllers.ParseEscalationTiers(escalationTiers)
+	if err != nil {
+		setupLog.Error(err, "invalid escalation tiers")
+		os.Exit(1)
+	}
+
+	var archiver archive.Sink
+	if archiveSink != "" {
+		var err error
+		archiver, err = archive.NewSink(archiveSink)
+		if err != nil {
+			setupLog.Error(err, "unable to create archive sink")
+			os.Exit(1)
+		}
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:             scheme,
 		MetricsBindAddress: metricsAddr,
 		Port:               9443,
+		CertDir:            webhookCertDir,
 		LeaderElection:     enableLeaderElection,
 		LeaderElectionID:   leaderElectionID,
 	})
@@ -71,13 +131,72 @@ func main() {
 	}
 
 	if err = (&controllers.AccessRequestReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("AccessRequest"),
-		Scheme: mgr.GetScheme(),
+		Client:                  mgr.GetClient(),
+		Log:                     ctrl.Log.WithName("controllers").WithName("AccessRequest"),
+		Scheme:                  mgr.GetScheme(),
+		Recorder:                mgr.GetEventRecorderFor("access-request-controller"),
+		BreakGlassMaxDuration:   breakGlassMaxDuration,
+		ReviewPeriod:            reviewPeriod,
+		ReviewReminderInterval:  reviewReminderInterval,
+		Archiver:                archiver,
+		TTLSecondsAfterFinished: defaultTTLSecondsAfterFinished,
+		PendingTTL:              pendingTTL,
+		ApprovalValidity:        approvalValidity,
+		EscalationTiers:         tiers,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "AccessRequest")
 		os.Exit(1)
 	}
+	if enableWebhook {
+		var ticketRegexp *regexp.Regexp
+		if ticketPattern != "" {
+			ticketRegexp, err = regexp.Compile(ticketPattern)
+			if err != nil {
+				setupLog.Error(err, "invalid ticket pattern")
+				os.Exit(1)
+			}
+		}
+		webhookServer := mgr.GetWebhookServer()
+		webhookServer.Register("/mutate", &crwebhook.Admission{Handler: &webhook.AccessRequestMutator{
+			Client: mgr.GetClient(),
+			Log:    ctrl.Log.WithName("webhooks").WithName("mutate"),
+		}})
+		webhookServer.Register("/validate", &crwebhook.Admission{Handler: &webhook.AccessRequestValidator{
+			Client:        mgr.GetClient(),
+			Log:           ctrl.Log.WithName("webhooks").WithName("validate"),
+			TicketPattern: ticketRegexp,
+		}})
+		webhookServer.Register("/validate-rolebinding", &crwebhook.Admission{Handler: &webhook.RoleBindingValidator{
+			Client:             mgr.GetClient(),
+			Log:                ctrl.Log.WithName("webhooks").WithName("validate-rolebinding"),
+			ControllerUsername: controllerUsername,
+		}})
+		webhookServer.Register("/validate-approverdelegation", &crwebhook.Admission{Handler: &webhook.ApproverDelegationValidator{
+			Log:         ctrl.Log.WithName("webhooks").WithName("validate-approverdelegation"),
+			MaxDuration: maxDelegationDuration,
+		}})
+	}
+	if catalogPort != 0 {
+		certDir := webhookCertDir
+		if certDir == "" {
+			// The default directory of the webhook server
+			certDir = filepath.Join(os.TempDir(), "k8s-webhook-server", "serving-certs")
+		}
+		// The authentication configuration is read directly rather than caching every configmap
+		if err := mgr.Add(&catalog.Server{
+			Handler: &catalog.Handler{
+				Catalog:       &catalog.Catalog{Client: mgr.GetClient()},
+				Authenticator: &catalog.RequestHeaderAuthenticator{Reader: mgr.GetAPIReader()},
+				Log:           ctrl.Log.WithName("catalog"),
+			},
+			Port:     catalogPort,
+			CertFile: filepath.Join(certDir, "tls.crt"),
+			KeyFile:  filepath.Join(certDir, "tls.key"),
+		}); err != nil {
+			setupLog.Error(err, "unable to add catalog server")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
 	setupLog.Info("starting manager")
@@ -0,0 +1,102 @@
+// kubectl-access is a kubectl plugin for working with AccessRequests. Once installed on the PATH it
+// is invoked as kubectl access
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/dippynark/access-request-controller/pkg/catalog"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const usage = `Usage: kubectl access <command> [flags]
+
+Commands:
+  catalog  List the roles that you may request in each namespace
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(1)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "catalog":
+		err = runCatalog(os.Args[2:])
+	case "-h", "--help", "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// runCatalog lists the roles that the current user may request, as computed by the catalog API
+// that the apiserver serves through its aggregation layer
+func runCatalog(args []string) error {
+	flags := flag.NewFlagSet("catalog", flag.ExitOnError)
+	namespace := flags.String("namespace", "", "Only list roles that may be requested in this namespace.")
+	kubeconfig := flags.String("kubeconfig", "", "Path to the kubeconfig file to use.")
+	kubeContext := flags.String("context", "", "The kubeconfig context to use.")
+	flags.Parse(args)
+
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = *kubeconfig
+	restConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{
+		CurrentContext: *kubeContext,
+	}).ClientConfig()
+	if err != nil {
+		return err
+	}
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return err
+	}
+
+	// The apiserver authenticates the user with the credentials of the kubeconfig, whatever their
+	// type, and identifies them to the catalog
+	path := catalog.Path + "/" + catalog.Resource
+	if *namespace != "" {
+		path = catalog.Path + "/namespaces/" + *namespace + "/" + catalog.Resource
+	}
+	body, err := clientset.Discovery().RESTClient().Get().AbsPath(path).DoRaw(context.TODO())
+	if err != nil {
+		return fmt.Errorf("unable to list catalog: %v", err)
+	}
+
+	list := catalog.List{}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return err
+	}
+	if len(list.Items) == 0 {
+		fmt.Fprintln(os.Stderr, "No requestable roles found.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tKIND\tNAME\tMAX DURATION\tAPPROVER GROUP\tOWNER\tDESCRIPTION")
+	for _, entry := range list.Items {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", entry.Namespace, entry.Kind, entry.Name, valueOrNone(entry.MaxDuration), valueOrNone(entry.ApproverGroup), valueOrNone(entry.Owner), entry.Description)
+	}
+	return w.Flush()
+}
+
+// valueOrNone returns the given value or <none> if it is empty, as kubectl does
+func valueOrNone(value string) string {
+	if value == "" {
+		return "<none>"
+	}
+	return value
+}
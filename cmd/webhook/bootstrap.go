@@ -0,0 +1,586 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	iamv1alpha1 "github.com/dippynark/access-request-controller/api/v1alpha1"
+	"github.com/dippynark/access-request-controller/pkg/catalog"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+const (
+	caCertificateKey = "ca.crt"
+	caPrivateKeyKey  = "ca.key"
+	// namespaceNameLabel is set by the apiserver on every namespace to its name
+	namespaceNameLabel = "kubernetes.io/metadata.name"
+
+	caValidity          = 10 * 365 * 24 * time.Hour
+	servingCertValidity = 365 * 24 * time.Hour
+	// servingCertRenewBefore is how long before expiry the serving certificate is regenerated
+	servingCertRenewBefore = 30 * 24 * time.Hour
+
+	mutatingWebhookName           = "webhook.accessrequests.iam.dippynark.co.uk"
+	validatingWebhookName         = "webhook.accessrequests.iam.dippynark.co.uk"
+	roleBindingWebhookName        = "webhook.rolebindings.iam.dippynark.co.uk"
+	roleBindingNameWebhookName    = "names.rolebindings.iam.dippynark.co.uk"
+	approverDelegationWebhookName = "webhook.approverdelegations.iam.dippynark.co.uk"
+	// catalogAPIServiceName is the name of the apiservice registering the catalog API
+	catalogAPIServiceName = catalog.Version + "." + catalog.GroupName
+)
+
+var apiServiceResource = schema.GroupVersionResource{Group: "apiregistration.k8s.io", Version: "v1", Resource: "apiservices"}
+
+// BootstrapConfig contains the configuration used by the webhook to generate its own serving
+// certificate and register itself with the apiserver, removing the dependency on cert-manager.
+type BootstrapConfig struct {
+	CertFile string
+	KeyFile  string
+
+	// SecretName is the name of the secret in ServiceNamespace used to store the generated CA and
+	// serving certificate so that they are shared between replicas and restarts
+	SecretName string
+	// ServiceName and ServiceNamespace identify the service that the apiserver uses to reach the
+	// webhook
+	ServiceName      string
+	ServiceNamespace string
+	// WebhookConfigurationName is the name of the mutating and validating webhook configurations
+	WebhookConfigurationName string
+	// NamespaceSelector restricts the namespaces whose accessrequests are sent to the webhook
+	NamespaceSelector *metav1.LabelSelector
+	// SystemNamespaces are the namespaces whose rolebindings are never sent to the webhook, such as
+	// kube-system and the namespaces of the webhook and controller, so that an unavailable webhook
+	// does not block them
+	SystemNamespaces []string
+	// TimeoutSeconds is the time the apiserver waits for the webhook to respond
+	TimeoutSeconds int32
+	// CatalogPort, if set, is the port of the service on which the catalog is served. The catalog
+	// API is registered with the apiserver's aggregation layer
+	CatalogPort int32
+}
+
+// bootstrap ensures a serving certificate exists, writes it to disk for the certificate watcher
+// and registers the webhook configurations and catalog API with the corresponding CA bundle
+func bootstrap(clientset kubernetes.Interface, dynamicClient dynamic.Interface, config BootstrapConfig) error {
+	ctx := context.TODO()
+
+	secret, err := ensureServingCertSecret(ctx, clientset, config)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFile(config.CertFile, secret.Data[corev1.TLSCertKey]); err != nil {
+		return err
+	}
+	if err := writeFile(config.KeyFile, secret.Data[corev1.TLSPrivateKeyKey]); err != nil {
+		return err
+	}
+
+	caBundle := secret.Data[caCertificateKey]
+	if err := ensureMutatingWebhookConfiguration(ctx, clientset, config, caBundle); err != nil {
+		return err
+	}
+	if err := ensureValidatingWebhookConfiguration(ctx, clientset, config, caBundle); err != nil {
+		return err
+	}
+	if config.CatalogPort == 0 {
+		return nil
+	}
+	return ensureCatalogAPIService(ctx, dynamicClient, config, caBundle)
+}
+
+// ensureServingCertSecret returns the secret holding the serving certificate, generating a serving
+// certificate if the secret does not exist or the certificate is due for renewal. The CA is kept
+// when the serving certificate is renewed so that replicas still serving the previous certificate
+// remain trusted. If the CA itself is replaced, the previous CA is kept in the CA bundle until the
+// next renewal
+func ensureServingCertSecret(ctx context.Context, clientset kubernetes.Interface, config BootstrapConfig) (*corev1.Secret, error) {
+	dnsNames := []string{
+		config.ServiceName,
+		fmt.Sprintf("%s.%s", config.ServiceName, config.ServiceNamespace),
+		fmt.Sprintf("%s.%s.svc", config.ServiceName, config.ServiceNamespace),
+		fmt.Sprintf("%s.%s.svc.cluster.local", config.ServiceName, config.ServiceNamespace),
+	}
+
+	secrets := clientset.CoreV1().Secrets(config.ServiceNamespace)
+	secret, err := secrets.Get(ctx, config.SecretName, metav1.GetOptions{})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return nil, err
+	}
+	exists := err == nil
+	if exists && servingCertValid(secret, dnsNames) {
+		return secret, nil
+	}
+
+	var caBundle, caKey []byte
+	if exists {
+		caBundle, caKey = secret.Data[caCertificateKey], secret.Data[caPrivateKeyKey]
+	}
+	ca, err := parseCA(caBundle, caKey)
+	if err != nil {
+		klog.Infof("generating CA because the existing CA cannot be used: %v", err)
+		caCert, caKeyPEM, err := generateCA()
+		if err != nil {
+			return nil, err
+		}
+		// Keep the previous CA so that certificates it signed are trusted until the next renewal
+		previousCA := firstCertificate(caBundle)
+		caBundle, caKey = append(caCert, previousCA...), caKeyPEM
+		if ca, err = parseCA(caBundle, caKey); err != nil {
+			return nil, err
+		}
+	}
+
+	klog.Infof("generating serving certificate for %s", dnsNames[2])
+	cert, key, err := generateServingCert(dnsNames, ca)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      config.SecretName,
+				Namespace: config.ServiceNamespace,
+			},
+			Type: corev1.SecretTypeTLS,
+		}
+	}
+	secret.Data = map[string][]byte{
+		caCertificateKey:        caBundle,
+		caPrivateKeyKey:         caKey,
+		corev1.TLSCertKey:       cert,
+		corev1.TLSPrivateKeyKey: key,
+	}
+
+	if !exists {
+		created, err := secrets.Create(ctx, secret, metav1.CreateOptions{})
+		if k8serrors.IsAlreadyExists(err) {
+			// Another replica created the secret first so use its certificate
+			return secrets.Get(ctx, config.SecretName, metav1.GetOptions{})
+		}
+		return created, err
+	}
+	updated, err := secrets.Update(ctx, secret, metav1.UpdateOptions{})
+	if k8serrors.IsConflict(err) {
+		// Another replica renewed the certificate first so use its certificate
+		return secrets.Get(ctx, config.SecretName, metav1.GetOptions{})
+	}
+	return updated, err
+}
+
+// servingCertValid returns whether the secret contains a serving certificate for the given DNS
+// names, signed by a CA whose key is stored alongside it, that is not due for renewal
+func servingCertValid(secret *corev1.Secret, dnsNames []string) bool {
+	if _, err := parseCA(secret.Data[caCertificateKey], secret.Data[caPrivateKeyKey]); err != nil || len(secret.Data[corev1.TLSPrivateKeyKey]) == 0 {
+		return false
+	}
+	block, _ := pem.Decode(secret.Data[corev1.TLSCertKey])
+	if block == nil {
+		return false
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return false
+	}
+	if time.Now().Add(servingCertRenewBefore).After(cert.NotAfter) {
+		return false
+	}
+	for _, dnsName := range dnsNames {
+		if err := cert.VerifyHostname(dnsName); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// certificateAuthority is a CA used to sign serving certificates
+type certificateAuthority struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// parseCA returns the CA whose certificate is the first in the given PEM encoded bundle. An error is
+// returned if the CA cannot be parsed or expires before a serving certificate signed now would
+func parseCA(caBundle, caKey []byte) (*certificateAuthority, error) {
+	certBlock, _ := pem.Decode(caBundle)
+	if certBlock == nil {
+		return nil, fmt.Errorf("no CA certificate found")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	keyBlock, _ := pem.Decode(caKey)
+	if keyBlock == nil {
+		return nil, fmt.Errorf("no CA key found")
+	}
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if !key.PublicKey.Equal(cert.PublicKey) {
+		return nil, fmt.Errorf("CA key does not match CA certificate")
+	}
+	if time.Now().Add(servingCertValidity).After(cert.NotAfter) {
+		return nil, fmt.Errorf("CA expires at %s", cert.NotAfter)
+	}
+	return &certificateAuthority{cert: cert, key: key}, nil
+}
+
+// firstCertificate returns the first PEM encoded certificate in the given bundle
+func firstCertificate(bundle []byte) []byte {
+	block, _ := pem.Decode(bundle)
+	if block == nil {
+		return nil
+	}
+	return pem.EncodeToMemory(block)
+}
+
+// generateCA generates a self-signed CA, returning the PEM encoded CA certificate and key
+func generateCA() ([]byte, []byte, error) {
+	now := time.Now()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	caSerialNumber, err := newSerialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          caSerialNumber,
+		Subject:               pkix.Name{CommonName: "access-request-webhook-ca"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	caKeyDER, err := x509.MarshalECPrivateKey(caKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: caKeyDER}),
+		nil
+}
+
+// generateServingCert generates a serving certificate for the given DNS names signed by the given
+// CA, returning the PEM encoded serving certificate and serving key
+func generateServingCert(dnsNames []string, ca *certificateAuthority) ([]byte, []byte, error) {
+	now := time.Now()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serialNumber, err := newSerialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject:      pkix.Name{CommonName: dnsNames[len(dnsNames)-2]},
+		DNSNames:     dnsNames,
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(servingCertValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+		nil
+}
+
+func newSerialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+// writeFile writes data to the given path if its contents differ so that the certificate watcher
+// is only triggered when the certificate changes
+func writeFile(path string, data []byte) error {
+	if existing, err := ioutil.ReadFile(path); err == nil && bytes.Equal(existing, data) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+func ensureMutatingWebhookConfiguration(ctx context.Context, clientset kubernetes.Interface, config BootstrapConfig, caBundle []byte) error {
+	path := "/mutate"
+	sideEffects := admissionregistrationv1.SideEffectClassNone
+	failurePolicy := admissionregistrationv1.Fail
+	webhooks := []admissionregistrationv1.MutatingWebhook{
+		{
+			Name:                    mutatingWebhookName,
+			AdmissionReviewVersions: []string{"v1beta1"},
+			ClientConfig: admissionregistrationv1.WebhookClientConfig{
+				Service: &admissionregistrationv1.ServiceReference{
+					Name:      config.ServiceName,
+					Namespace: config.ServiceNamespace,
+					Path:      &path,
+				},
+				CABundle: caBundle,
+			},
+			FailurePolicy:     &failurePolicy,
+			NamespaceSelector: config.NamespaceSelector,
+			Rules:             accessRequestRules(admissionregistrationv1.Create, admissionregistrationv1.Update),
+			SideEffects:       &sideEffects,
+			TimeoutSeconds:    &config.TimeoutSeconds,
+		},
+	}
+
+	client := clientset.AdmissionregistrationV1().MutatingWebhookConfigurations()
+	webhookConfiguration, err := client.Get(ctx, config.WebhookConfigurationName, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		_, err = client.Create(ctx, &admissionregistrationv1.MutatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: config.WebhookConfigurationName},
+			Webhooks:   webhooks,
+		}, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	webhookConfiguration.Webhooks = webhooks
+	_, err = client.Update(ctx, webhookConfiguration, metav1.UpdateOptions{})
+	return err
+}
+
+func ensureValidatingWebhookConfiguration(ctx context.Context, clientset kubernetes.Interface, config BootstrapConfig, caBundle []byte) error {
+	path := "/validate"
+	roleBindingPath := "/validate-rolebinding"
+	approverDelegationPath := "/validate-approverdelegation"
+	sideEffects := admissionregistrationv1.SideEffectClassNone
+	failurePolicy := admissionregistrationv1.Fail
+	ignoreFailurePolicy := admissionregistrationv1.Ignore
+	roleBindingNamespaceSelector := systemNamespacesExcluded(config.NamespaceSelector, config.SystemNamespaces)
+	webhooks := []admissionregistrationv1.ValidatingWebhook{
+		{
+			Name:                    validatingWebhookName,
+			AdmissionReviewVersions: []string{"v1beta1"},
+			ClientConfig: admissionregistrationv1.WebhookClientConfig{
+				Service: &admissionregistrationv1.ServiceReference{
+					Name:      config.ServiceName,
+					Namespace: config.ServiceNamespace,
+					Path:      &path,
+				},
+				CABundle: caBundle,
+			},
+			FailurePolicy:     &failurePolicy,
+			NamespaceSelector: config.NamespaceSelector,
+			Rules:             accessRequestRules(admissionregistrationv1.Create, admissionregistrationv1.Update, admissionregistrationv1.Delete),
+			SideEffects:       &sideEffects,
+			TimeoutSeconds:    &config.TimeoutSeconds,
+		},
+		{
+			Name:                    roleBindingWebhookName,
+			AdmissionReviewVersions: []string{"v1beta1"},
+			ClientConfig: admissionregistrationv1.WebhookClientConfig{
+				Service: &admissionregistrationv1.ServiceReference{
+					Name:      config.ServiceName,
+					Namespace: config.ServiceNamespace,
+					Path:      &roleBindingPath,
+				},
+				CABundle: caBundle,
+			},
+			FailurePolicy:     &failurePolicy,
+			NamespaceSelector: roleBindingNamespaceSelector,
+			// Only rolebindings controlled by accessrequests are protected
+			ObjectSelector: &metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: iamv1alpha1.AccessRequestUIDLabel, Operator: metav1.LabelSelectorOpExists},
+				},
+			},
+			Rules:          roleBindingRules(admissionregistrationv1.Create, admissionregistrationv1.Update, admissionregistrationv1.Delete),
+			SideEffects:    &sideEffects,
+			TimeoutSeconds: &config.TimeoutSeconds,
+		},
+		// Rolebindings colliding with pending accessrequests are denied on a best effort basis so
+		// that other rolebindings can be created while the webhook is unavailable
+		{
+			Name:                    roleBindingNameWebhookName,
+			AdmissionReviewVersions: []string{"v1beta1"},
+			ClientConfig: admissionregistrationv1.WebhookClientConfig{
+				Service: &admissionregistrationv1.ServiceReference{
+					Name:      config.ServiceName,
+					Namespace: config.ServiceNamespace,
+					Path:      &roleBindingPath,
+				},
+				CABundle: caBundle,
+			},
+			FailurePolicy:     &ignoreFailurePolicy,
+			NamespaceSelector: roleBindingNamespaceSelector,
+			ObjectSelector: &metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: iamv1alpha1.AccessRequestUIDLabel, Operator: metav1.LabelSelectorOpDoesNotExist},
+				},
+			},
+			Rules:          roleBindingRules(admissionregistrationv1.Create),
+			SideEffects:    &sideEffects,
+			TimeoutSeconds: &config.TimeoutSeconds,
+		},
+		// Approverdelegations are cluster-scoped so the namespace selector does not apply
+		{
+			Name:                    approverDelegationWebhookName,
+			AdmissionReviewVersions: []string{"v1beta1"},
+			ClientConfig: admissionregistrationv1.WebhookClientConfig{
+				Service: &admissionregistrationv1.ServiceReference{
+					Name:      config.ServiceName,
+					Namespace: config.ServiceNamespace,
+					Path:      &approverDelegationPath,
+				},
+				CABundle: caBundle,
+			},
+			FailurePolicy: &failurePolicy,
+			Rules: []admissionregistrationv1.RuleWithOperations{
+				{
+					Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Create, admissionregistrationv1.Update},
+					Rule: admissionregistrationv1.Rule{
+						APIGroups:   []string{iamv1alpha1.GroupVersion.Group},
+						APIVersions: []string{iamv1alpha1.GroupVersion.Version},
+						Resources:   []string{"approverdelegations"},
+					},
+				},
+			},
+			SideEffects:    &sideEffects,
+			TimeoutSeconds: &config.TimeoutSeconds,
+		},
+	}
+
+	client := clientset.AdmissionregistrationV1().ValidatingWebhookConfigurations()
+	webhookConfiguration, err := client.Get(ctx, config.WebhookConfigurationName, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		_, err = client.Create(ctx, &admissionregistrationv1.ValidatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: config.WebhookConfigurationName},
+			Webhooks:   webhooks,
+		}, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	webhookConfiguration.Webhooks = webhooks
+	_, err = client.Update(ctx, webhookConfiguration, metav1.UpdateOptions{})
+	return err
+}
+
+// ensureCatalogAPIService registers the catalog API with the apiserver's aggregation layer, which
+// authenticates and authorizes users before proxying their requests to the catalog
+func ensureCatalogAPIService(ctx context.Context, dynamicClient dynamic.Interface, config BootstrapConfig, caBundle []byte) error {
+	spec := map[string]interface{}{
+		"group":                catalog.GroupName,
+		"version":              catalog.Version,
+		"groupPriorityMinimum": int64(1000),
+		"versionPriority":      int64(15),
+		"caBundle":             base64.StdEncoding.EncodeToString(caBundle),
+		"service": map[string]interface{}{
+			"name":      config.ServiceName,
+			"namespace": config.ServiceNamespace,
+			"port":      int64(config.CatalogPort),
+		},
+	}
+
+	client := dynamicClient.Resource(apiServiceResource)
+	apiService, err := client.Get(ctx, catalogAPIServiceName, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		apiService = &unstructured.Unstructured{}
+		apiService.SetAPIVersion(apiServiceResource.GroupVersion().String())
+		apiService.SetKind("APIService")
+		apiService.SetName(catalogAPIServiceName)
+		apiService.Object["spec"] = spec
+		_, err = client.Create(ctx, apiService, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	apiService.Object["spec"] = spec
+	_, err = client.Update(ctx, apiService, metav1.UpdateOptions{})
+	return err
+}
+
+// accessRequestRules returns the rules matching the given operations on accessrequests
+func accessRequestRules(operations ...admissionregistrationv1.OperationType) []admissionregistrationv1.RuleWithOperations {
+	return []admissionregistrationv1.RuleWithOperations{
+		{
+			Operations: operations,
+			Rule: admissionregistrationv1.Rule{
+				APIGroups:   []string{iamv1alpha1.GroupVersion.Group},
+				APIVersions: []string{iamv1alpha1.GroupVersion.Version},
+				Resources:   []string{accessRequestResourcePlural},
+			},
+		},
+	}
+}
+
+// roleBindingRules returns the rules matching the given operations on rolebindings
+func roleBindingRules(operations ...admissionregistrationv1.OperationType) []admissionregistrationv1.RuleWithOperations {
+	return []admissionregistrationv1.RuleWithOperations{
+		{
+			Operations: operations,
+			Rule: admissionregistrationv1.Rule{
+				APIGroups:   []string{rbacv1.GroupName},
+				APIVersions: []string{rbacv1.SchemeGroupVersion.Version},
+				Resources:   []string{"rolebindings"},
+			},
+		},
+	}
+}
+
+// systemNamespacesExcluded returns the given namespace selector restricted to exclude the given
+// namespaces by name
+func systemNamespacesExcluded(selector *metav1.LabelSelector, namespaces []string) *metav1.LabelSelector {
+	excluded := &metav1.LabelSelector{}
+	if selector != nil {
+		excluded = selector.DeepCopy()
+	}
+	if len(namespaces) > 0 {
+		excluded.MatchExpressions = append(excluded.MatchExpressions, metav1.LabelSelectorRequirement{
+			Key:      namespaceNameLabel,
+			Operator: metav1.LabelSelectorOpNotIn,
+			Values:   namespaces,
+		})
+	}
+	return excluded
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"k8s.io/klog/v2"
+)
+
+// certWatcher serves the most recently loaded serving certificate, reloading it when the
+// certificate or key file changes on disk so that rotated certificates are served without a
+// restart
+type certWatcher struct {
+	sync.RWMutex
+
+	certFile    string
+	keyFile     string
+	certificate *tls.Certificate
+	watcher     *fsnotify.Watcher
+}
+
+func newCertWatcher(certFile, keyFile string) (*certWatcher, error) {
+	cw := &certWatcher{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	if _, err := cw.load(); err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	// Watch the directories containing the files rather than the files themselves because the
+	// kubelet updates mounted secrets by atomically swapping a symlink, which replaces the files
+	dirs := map[string]bool{
+		filepath.Dir(certFile): true,
+		filepath.Dir(keyFile):  true,
+	}
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return nil, err
+		}
+	}
+	cw.watcher = watcher
+
+	return cw, nil
+}
+
+// GetCertificate returns the current serving certificate
+func (cw *certWatcher) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cw.RLock()
+	defer cw.RUnlock()
+	return cw.certificate, nil
+}
+
+// Watch reloads the serving certificate whenever the watched directories change until the watcher
+// is closed
+func (cw *certWatcher) Watch() {
+	for {
+		select {
+		case event, ok := <-cw.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Remove|fsnotify.Rename) != 0 {
+				cw.reload()
+			}
+		case err, ok := <-cw.watcher.Errors:
+			if !ok {
+				return
+			}
+			klog.Errorf("certificate watcher error: %v", err)
+		}
+	}
+}
+
+func (cw *certWatcher) reload() {
+	changed, err := cw.load()
+	if err != nil {
+		// The certificate and key may be updated separately so keep serving the previous
+		// certificate until both are consistent
+		klog.Errorf("failed to reload serving certificate: %v", err)
+		certificateReloadsTotal.WithLabelValues("failure").Inc()
+		return
+	}
+	if changed {
+		klog.Infof("reloaded serving certificate from %s", cw.certFile)
+		certificateReloadsTotal.WithLabelValues("success").Inc()
+	}
+}
+
+// load reads the certificate and key files and returns whether the serving certificate changed
+func (cw *certWatcher) load() (bool, error) {
+	certificate, err := tls.LoadX509KeyPair(cw.certFile, cw.keyFile)
+	if err != nil {
+		return false, err
+	}
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		return false, err
+	}
+	certificate.Leaf = leaf
+
+	cw.Lock()
+	defer cw.Unlock()
+
+	if cw.certificate != nil && bytes.Equal(cw.certificate.Certificate[0], certificate.Certificate[0]) {
+		return false, nil
+	}
+	cw.certificate = &certificate
+	certificateExpiryTimestampSeconds.Set(float64(leaf.NotAfter.Unix()))
+
+	return true, nil
+}
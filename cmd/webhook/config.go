@@ -2,24 +2,92 @@ package main
 
 import (
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
 
 	"k8s.io/klog/v2"
 )
 
-// Config contains the server (the webhook) cert and key.
+// Config contains the server (the webhook) cert and key and the configuration used to authenticate
+// clients (the apiserver).
 type Config struct {
 	CertFile string
 	KeyFile  string
+	// ClientCAFile, if set, enables mutual TLS by requiring clients to present a certificate signed
+	// by one of the CAs in the file
+	ClientCAFile string
+	// AllowedClientNames, if set, restricts the clients allowed to connect to those presenting a
+	// certificate with a matching common name or subject alternative name
+	AllowedClientNames []string
 }
 
 func configTLS(config Config) *tls.Config {
-	sCert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+	// Serve the certificate through a watcher so that rotated certificates are picked up without a
+	// restart
+	certWatcher, err := newCertWatcher(config.CertFile, config.KeyFile)
 	if err != nil {
 		klog.Fatal(err)
 	}
-	return &tls.Config{
-		Certificates: []tls.Certificate{sCert},
-		// TODO: uses mutual tls after we agree on what cert the apiserver should use.
-		// ClientAuth:   tls.RequireAndVerifyClientCert,
+	go certWatcher.Watch()
+
+	tlsConfig := &tls.Config{
+		GetCertificate: certWatcher.GetCertificate,
+	}
+
+	if config.ClientCAFile == "" {
+		if len(config.AllowedClientNames) > 0 {
+			klog.Fatal("allowed client names require a client CA file")
+		}
+		return tlsConfig
+	}
+
+	clientCAs, err := ioutil.ReadFile(config.ClientCAFile)
+	if err != nil {
+		klog.Fatal(err)
+	}
+	clientCAPool := x509.NewCertPool()
+	if !clientCAPool.AppendCertsFromPEM(clientCAs) {
+		klog.Fatalf("no certificates found in %s", config.ClientCAFile)
+	}
+	tlsConfig.ClientCAs = clientCAPool
+	tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	if len(config.AllowedClientNames) > 0 {
+		tlsConfig.VerifyPeerCertificate = verifyClientNames(config.AllowedClientNames)
+	}
+
+	return tlsConfig
+}
+
+// verifyClientNames returns a function that verifies that the client certificate has a common name
+// or subject alternative name in the given list. It is only called once the certificate chain has
+// been verified against the client CAs
+func verifyClientNames(allowedClientNames []string) func([][]byte, [][]*x509.Certificate) error {
+	allowed := map[string]bool{}
+	for _, name := range allowedClientNames {
+		allowed[name] = true
+	}
+
+	return func(_ [][]byte, verifiedChains [][]*x509.Certificate) error {
+		if len(verifiedChains) == 0 || len(verifiedChains[0]) == 0 {
+			return errors.New("no verified client certificate")
+		}
+		cert := verifiedChains[0][0]
+
+		names := append([]string{cert.Subject.CommonName}, cert.DNSNames...)
+		names = append(names, cert.EmailAddresses...)
+		for _, uri := range cert.URIs {
+			names = append(names, uri.String())
+		}
+		for _, name := range names {
+			if allowed[name] {
+				return nil
+			}
+		}
+
+		err := fmt.Errorf("client certificate %q is not allowed", cert.Subject.CommonName)
+		klog.Error(err)
+		return err
 	}
 }
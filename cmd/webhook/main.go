@@ -1,41 +1,92 @@
 package main
 
 import (
-	"encoding/json"
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"net/http"
-
-	v1 "k8s.io/api/admission/v1"
-	"k8s.io/api/admission/v1beta1"
-	"k8s.io/apimachinery/pkg/runtime"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/dippynark/access-request-controller/pkg/catalog"
+	"github.com/dippynark/access-request-controller/pkg/webhook"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/klog/v2"
-	// TODO: try this library to see if it generates correct json patch
-	// https://github.com/mattbaird/jsonpatch
+	"k8s.io/klog/v2/klogr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
 const (
-	accessRequestResourceSingular = "accessrequest"
-	accessRequestResourcePlural   = "accessrequests"
-	approveVerb                   = "approve"
+	accessRequestResourcePlural = "accessrequests"
+
+	serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+	// bootstrapInterval is how often the serving certificate and webhook configurations are
+	// reconciled in bootstrap mode
+	bootstrapInterval = time.Hour
 )
 
 var (
-	certFile string
-	keyFile  string
-	port     int
+	certFile           string
+	keyFile            string
+	clientCAFile       string
+	allowedClientNames string
+	port               int
+	catalogPort        int
+	metricsAddr        string
+	ticketPattern      string
+
+	maxDelegationDuration time.Duration
+
+	bootstrapEnabled         bool
+	bootstrapSecretName      string
+	serviceName              string
+	serviceNamespace         string
+	webhookConfigurationName string
+	namespaceSelector        string
+	timeoutSeconds           int
+
+	controllerUsername string
 )
 
 func main() {
 
 	flag.StringVar(&certFile, "tls-cert-file", "", "File containing the default x509 Certificate for HTTPS. (CA cert, if any, concatenated after server cert).")
 	flag.StringVar(&keyFile, "tls-private-key-file", "", "File containing the default x509 private key matching --tls-cert-file.")
+	flag.StringVar(&clientCAFile, "client-ca-file", "", "File containing the x509 CA certificates used to verify client certificates. If set, clients must present a valid certificate.")
+	flag.StringVar(&allowedClientNames, "allowed-client-names", "", "Comma-separated list of common names or subject alternative names that client certificates must match. Requires --client-ca-file.")
 	flag.IntVar(&port, "port", 9443, "Secure port that the webhook listens on")
+	flag.IntVar(&catalogPort, "catalog-port", 0, "Secure port that the role catalog API is served on to the apiserver's aggregation layer. If 0, the catalog is not served.")
+	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
+	flag.StringVar(&ticketPattern, "ticket-pattern", "", "Regular expression that AccessRequest tickets must match. If set, AccessRequests must reference a ticket.")
+	flag.BoolVar(&bootstrapEnabled, "bootstrap", false, "Generate a self-signed serving certificate and register the webhook configurations instead of relying on cert-manager.")
+	flag.StringVar(&bootstrapSecretName, "bootstrap-secret-name", "access-request-webhook-server-cert", "Name of the secret used to store the generated serving certificate. Requires --bootstrap.")
+	flag.StringVar(&serviceName, "service-name", "access-request-webhook", "Name of the service used to reach the webhook. Requires --bootstrap.")
+	flag.StringVar(&serviceNamespace, "service-namespace", "", "Namespace of the service used to reach the webhook. Defaults to the namespace of the webhook's service account. Requires --bootstrap.")
+	flag.StringVar(&webhookConfigurationName, "webhook-configuration-name", "access-request-webhook", "Name of the mutating and validating webhook configurations. Requires --bootstrap.")
+	flag.StringVar(&namespaceSelector, "namespace-selector", "", "Label selector restricting the namespaces whose AccessRequests are sent to the webhook, for example 'environment in (production)'. Requires --bootstrap.")
+	flag.IntVar(&timeoutSeconds, "timeout-seconds", 10, "Time in seconds the API server waits for the webhook to respond. Requires --bootstrap.")
+	flag.StringVar(&controllerUsername, "controller-username", "system:serviceaccount:access-request-controller-system:default", "Username of the controller's service account, which is the only user allowed to change RoleBindings controlled by AccessRequests.")
+	flag.DurationVar(&maxDelegationDuration, "max-delegation-duration", 0, "The longest time window that an ApproverDelegation may cover. Zero disables the limit.")
 	flag.Parse()
 
+	var ticketRegexp *regexp.Regexp
+	if ticketPattern != "" {
+		var err error
+		ticketRegexp, err = regexp.Compile(ticketPattern)
+		if err != nil {
+			klog.Fatalf("invalid ticket pattern: %v", err)
+		}
+	}
+
 	// TODO: create separate service account for webhook with minimal permissions just to verify
 	// approve verb
 	restConfig, err := clientcmd.BuildConfigFromFlags("", "")
@@ -46,14 +97,96 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		panic(err)
+	}
+	c, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		panic(err)
+	}
+
+	if bootstrapEnabled {
+		bootstrapConfig, err := newBootstrapConfig()
+		if err != nil {
+			panic(err)
+		}
+		certFile = bootstrapConfig.CertFile
+		keyFile = bootstrapConfig.KeyFile
+		if err := bootstrap(clientset, dynamicClient, bootstrapConfig); err != nil {
+			panic(err)
+		}
+		// Keep the serving certificate and webhook configurations up to date; renewed certificates
+		// are written to disk and picked up by the certificate watcher
+		go func() {
+			for range time.Tick(bootstrapInterval) {
+				if err := bootstrap(clientset, dynamicClient, bootstrapConfig); err != nil {
+					klog.Errorf("failed to bootstrap webhook: %v", err)
+				}
+			}
+		}()
+	}
 
 	http.HandleFunc("/readyz", func(w http.ResponseWriter, req *http.Request) { w.Write([]byte("ok")) })
-	http.HandleFunc("/mutate", serveMutateAccessRequest)
-	http.Handle("/validate", &serveValidateAccessRequestHandler{clientset: clientset})
+	http.Handle("/mutate", standaloneWebhook(&webhook.AccessRequestMutator{
+		Client: c,
+		Log:    klogr.New().WithName("mutate"),
+	}))
+	http.Handle("/validate", standaloneWebhook(&webhook.AccessRequestValidator{
+		Client:        c,
+		Log:           klogr.New().WithName("validate"),
+		TicketPattern: ticketRegexp,
+	}))
+	http.Handle("/validate-rolebinding", standaloneWebhook(&webhook.RoleBindingValidator{
+		Client:             c,
+		Log:                klogr.New().WithName("validate-rolebinding"),
+		ControllerUsername: controllerUsername,
+	}))
+	http.Handle("/validate-approverdelegation", standaloneWebhook(&webhook.ApproverDelegationValidator{
+		Log:         klogr.New().WithName("validate-approverdelegation"),
+		MaxDuration: maxDelegationDuration,
+	}))
 
 	config := Config{
-		CertFile: certFile,
-		KeyFile:  keyFile,
+		CertFile:     certFile,
+		KeyFile:      keyFile,
+		ClientCAFile: clientCAFile,
+	}
+	if allowedClientNames != "" {
+		config.AllowedClientNames = strings.Split(allowedClientNames, ",")
+	}
+
+	go func() {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", promhttp.Handler())
+		if err := http.ListenAndServe(metricsAddr, metricsMux); err != nil {
+			klog.Fatal(err)
+		}
+	}()
+
+	// The catalog is served to the apiserver's aggregation layer, whose client certificate is
+	// verified by the handler against the front proxy CA published by the apiserver
+	if catalogPort != 0 {
+		catalogHandler := &catalog.Handler{
+			Catalog:       &catalog.Catalog{Client: c},
+			Authenticator: &catalog.RequestHeaderAuthenticator{Reader: c},
+			Log:           klogr.New().WithName("catalog"),
+		}
+		catalogMux := http.NewServeMux()
+		catalogMux.Handle(catalog.Path, catalogHandler)
+		catalogMux.Handle(catalog.Path+"/", catalogHandler)
+		catalogTLSConfig := configTLS(Config{CertFile: certFile, KeyFile: keyFile})
+		catalogTLSConfig.ClientAuth = tls.RequestClientCert
+		catalogServer := &http.Server{
+			Addr:      fmt.Sprintf(":%d", catalogPort),
+			Handler:   catalogMux,
+			TLSConfig: catalogTLSConfig,
+		}
+		go func() {
+			if err := catalogServer.ListenAndServeTLS("", ""); err != nil {
+				klog.Fatal(err)
+			}
+		}()
 	}
 
 	server := &http.Server{
@@ -66,112 +199,56 @@ func main() {
 	}
 }
 
-func serveMutateAccessRequest(w http.ResponseWriter, r *http.Request) {
-	serve(w, r, newDelegateToV1AdmitHandler(mutateAccessRequest))
-}
-
-type serveValidateAccessRequestHandler struct {
-	clientset *kubernetes.Clientset
-}
-
-func (h *serveValidateAccessRequestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	serve(w, r, newDelegateToV1AdmitHandler(h.validateAccessRequest))
-}
-
-// admitv1beta1Func handles a v1beta1 admission
-type admitv1beta1Func func(v1beta1.AdmissionReview) *v1beta1.AdmissionResponse
-
-// admitv1beta1Func handles a v1 admission
-type admitv1Func func(v1.AdmissionReview) *v1.AdmissionResponse
-
-// admitHandler is a handler, for both validators and mutators, that supports multiple admission review versions
-type admitHandler struct {
-	v1beta1 admitv1beta1Func
-	v1      admitv1Func
-}
-
-func newDelegateToV1AdmitHandler(f admitv1Func) admitHandler {
-	return admitHandler{
-		v1beta1: delegateV1beta1AdmitToV1(f),
-		v1:      f,
+// newBootstrapConfig returns the bootstrap configuration from flags
+func newBootstrapConfig() (BootstrapConfig, error) {
+	config := BootstrapConfig{
+		CertFile:                 certFile,
+		KeyFile:                  keyFile,
+		SecretName:               bootstrapSecretName,
+		ServiceName:              serviceName,
+		ServiceNamespace:         serviceNamespace,
+		WebhookConfigurationName: webhookConfigurationName,
+		TimeoutSeconds:           int32(timeoutSeconds),
+		CatalogPort:              int32(catalogPort),
 	}
-}
-
-func delegateV1beta1AdmitToV1(f admitv1Func) admitv1beta1Func {
-	return func(review v1beta1.AdmissionReview) *v1beta1.AdmissionResponse {
-		in := v1.AdmissionReview{Request: convertAdmissionRequestToV1(review.Request)}
-		out := f(in)
-		return convertAdmissionResponseToV1beta1(out)
+	if config.CertFile == "" {
+		config.CertFile = filepath.Join(os.TempDir(), "access-request-webhook", "tls.crt")
 	}
-}
-
-// serve handles the http portion of a request prior to handing to an admit function
-func serve(w http.ResponseWriter, r *http.Request, admit admitHandler) {
-	var body []byte
-	if r.Body != nil {
-		if data, err := ioutil.ReadAll(r.Body); err == nil {
-			body = data
+	if config.KeyFile == "" {
+		config.KeyFile = filepath.Join(os.TempDir(), "access-request-webhook", "tls.key")
+	}
+	if config.ServiceNamespace == "" {
+		namespace, err := ioutil.ReadFile(serviceAccountNamespaceFile)
+		if err != nil {
+			return config, fmt.Errorf("failed to determine service namespace, set --service-namespace: %v", err)
 		}
+		config.ServiceNamespace = strings.TrimSpace(string(namespace))
 	}
-
-	// Verify the content type is accurate
-	contentType := r.Header.Get("Content-Type")
-	if contentType != "application/json" {
-		klog.Errorf("contentType=%s, expect application/json", contentType)
-		return
+	// Rolebindings in these namespaces are not protected so that the webhook cannot block the
+	// cluster or itself while it is unavailable
+	config.SystemNamespaces = []string{metav1.NamespaceSystem, config.ServiceNamespace}
+	if parts := strings.Split(controllerUsername, ":"); len(parts) == 4 && parts[0] == "system" && parts[1] == "serviceaccount" && parts[2] != config.ServiceNamespace {
+		config.SystemNamespaces = append(config.SystemNamespaces, parts[2])
 	}
-
-	klog.V(2).Info(fmt.Sprintf("handling request: %s", body))
-
-	deserializer := codecs.UniversalDeserializer()
-	obj, gvk, err := deserializer.Decode(body, nil, nil)
-	if err != nil {
-		msg := fmt.Sprintf("Request could not be decoded: %v", err)
-		klog.Error(msg)
-		http.Error(w, msg, http.StatusBadRequest)
-		return
-	}
-
-	var responseObj runtime.Object
-	switch *gvk {
-	case v1beta1.SchemeGroupVersion.WithKind("AdmissionReview"):
-		requestedAdmissionReview, ok := obj.(*v1beta1.AdmissionReview)
-		if !ok {
-			klog.Errorf("Expected v1beta1.AdmissionReview but got: %T", obj)
-			return
-		}
-		responseAdmissionReview := &v1beta1.AdmissionReview{}
-		responseAdmissionReview.SetGroupVersionKind(*gvk)
-		responseAdmissionReview.Response = admit.v1beta1(*requestedAdmissionReview)
-		responseAdmissionReview.Response.UID = requestedAdmissionReview.Request.UID
-		responseObj = responseAdmissionReview
-	case v1.SchemeGroupVersion.WithKind("AdmissionReview"):
-		requestedAdmissionReview, ok := obj.(*v1.AdmissionReview)
-		if !ok {
-			klog.Errorf("Expected v1.AdmissionReview but got: %T", obj)
-			return
+	if namespaceSelector != "" {
+		selector, err := metav1.ParseToLabelSelector(namespaceSelector)
+		if err != nil {
+			return config, fmt.Errorf("invalid --namespace-selector: %v", err)
 		}
-		responseAdmissionReview := &v1.AdmissionReview{}
-		responseAdmissionReview.SetGroupVersionKind(*gvk)
-		responseAdmissionReview.Response = admit.v1(*requestedAdmissionReview)
-		responseAdmissionReview.Response.UID = requestedAdmissionReview.Request.UID
-		responseObj = responseAdmissionReview
-	default:
-		msg := fmt.Sprintf("Unsupported group version kind: %v", gvk)
-		klog.Error(msg)
-		http.Error(w, msg, http.StatusBadRequest)
-		return
-	}
-
-	klog.V(2).Info(fmt.Sprintf("sending response: %v", responseObj))
-	respBytes, err := json.Marshal(responseObj)
-	if err != nil {
-		klog.Error(err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		config.NamespaceSelector = selector
 	}
-	w.Header().Set("Content-Type", "application/json")
-	if _, err := w.Write(respBytes); err != nil {
-		klog.Error(err)
+	return config, nil
+}
+
+// standaloneWebhook returns an http handler serving the given admission handler outside of a
+// controller manager
+func standaloneWebhook(handler admission.Handler) http.Handler {
+	h, err := admission.StandaloneWebhook(&admission.Webhook{Handler: handler}, admission.StandaloneOptions{
+		Scheme: scheme,
+		Logger: klogr.New(),
+	})
+	if err != nil {
+		panic(err)
 	}
+	return h
 }
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	certificateReloadsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "access_request_webhook_certificate_reloads_total",
+		Help: "Total number of serving certificate reloads by result.",
+	}, []string{"result"})
+
+	certificateExpiryTimestampSeconds = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "access_request_webhook_certificate_expiry_timestamp_seconds",
+		Help: "Expiry time of the current serving certificate in seconds since the Unix epoch.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(certificateReloadsTotal, certificateExpiryTimestampSeconds)
+}
@@ -20,33 +20,71 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	iamv1alpha1 "github.com/dippynark/access-request-controller/api/v1alpha1"
+	"github.com/dippynark/access-request-controller/pkg/archive"
+	"github.com/dippynark/access-request-controller/pkg/delegation"
+	"github.com/dippynark/access-request-controller/pkg/rules"
 	"github.com/go-logr/logr"
 	v1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/cluster-api/util/patch"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 // AccessRequestReconciler reconciles a AccessRequest object
 type AccessRequestReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// BreakGlassMaxDuration is the maximum duration that a break-glass accessrequest can grant access
+	// for
+	BreakGlassMaxDuration time.Duration
+	// ReviewPeriod is the period after activation within which a break-glass accessrequest must be
+	// reviewed by an approver
+	ReviewPeriod time.Duration
+	// ReviewReminderInterval is the interval at which overdue reviews are escalated
+	ReviewReminderInterval time.Duration
+	// Archiver, if set, stores records of finished accessrequests
+	Archiver archive.Sink
+	// TTLSecondsAfterFinished is the default time to live of finished accessrequests. If nil,
+	// finished accessrequests are only deleted if they set their own time to live
+	TTLSecondsAfterFinished *int32
+	// PendingTTL is the period after creation within which an accessrequest must be approved before
+	// it is closed. If zero, accessrequests wait for approval indefinitely
+	PendingTTL time.Duration
+	// ApprovalValidity is the period after approval within which an accessrequest must be activated
+	// before it must be approved again. If zero, approvals do not expire
+	ApprovalValidity time.Duration
+	// EscalationTiers escalate accessrequests that have not been approved in time to other groups of
+	// approvers, in order
+	EscalationTiers []EscalationTier
 }
 
 // +kubebuilder:rbac:groups=iam.dippynark.co.uk,resources=accessrequests,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=iam.dippynark.co.uk,resources=accessrequests/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
 // +kubebuilder:rbac:groups=coordination.k8s.io,resources=leases,verbs=get;list;create;update
-// +kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=rolebindings,verbs=get;list;watch;create
+// +kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=rolebindings,verbs=get;list;watch;create;delete
+// +kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=roles,verbs=get;list;watch;create;update;delete
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
 
 func (r *AccessRequestReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ctrl.Result, rerr error) {
 	log := r.Log.WithValues("accessrequest", req.NamespacedName)
@@ -61,6 +99,15 @@ func (r *AccessRequestReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		return ctrl.Result{}, err
 	}
 
+	// Delete finished accessrequests once their time to live has passed. Access granted by a finished
+	// accessrequest has already been revoked so this does not affect access
+	untilDeletion, ok := r.untilDeletion(accessRequest)
+	if ok && untilDeletion <= 0 && accessRequest.DeletionTimestamp.IsZero() {
+		log.Info("Deleting finished AccessRequest")
+		err := r.Delete(ctx, accessRequest, client.Preconditions{UID: &accessRequest.UID})
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
 	// Initialize the patch helper
 	patchHelper, err := patch.NewHelper(accessRequest, r.Client)
 	if err != nil {
@@ -80,96 +127,624 @@ func (r *AccessRequestReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		}
 	}()
 
+	// Handle deletion reconciliation loop
+	if !accessRequest.DeletionTimestamp.IsZero() {
+		return r.reconcileDelete(ctx, accessRequest)
+	}
+
+	// Add finalizer first if not exist to avoid the race condition between init and delete
+	if !controllerutil.ContainsFinalizer(accessRequest, accessRequestFinalizer) {
+		controllerutil.AddFinalizer(accessRequest, accessRequestFinalizer)
+		return ctrl.Result{}, nil
+	}
+
 	return r.reconcile(ctx, accessRequest)
 }
 
-func (r *AccessRequestReconciler) approvalAllowed(ctx context.Context, accessRequest *iamv1alpha1.AccessRequest) (bool, error) {
+// approvalAllowed returns whether every approver of the accessrequest is allowed to approve it and,
+// if not, the first approval that is not allowed
+func (r *AccessRequestReconciler) approvalAllowed(ctx context.Context, accessRequest *iamv1alpha1.AccessRequest) (bool, string, error) {
+	for _, approval := range iamv1alpha1.Approvals(accessRequest) {
+		// Break-glass accessrequests must be reviewed by someone other than the requester
+		if accessRequest.Spec.BreakGlass != nil && iamv1alpha1.ApprovedByRequester(accessRequest, approval) {
+			return false, delegation.Describe(approval), nil
+		}
 
-	// Verify approval permissions
-	sar, err := r.checkAccess(ctx, accessRequest)
-	if err != nil {
-		return false, err
-	}
+		// Verify approval permissions
+		allowed, err := r.approverAllowed(ctx, accessRequest, approval, accessRequest.Namespace)
+		if err != nil {
+			return false, "", err
+		}
 
-	if !sar.Status.Allowed || sar.Status.Denied {
-		return false, nil
+		if !allowed {
+			return false, delegation.Describe(approval), nil
+		}
 	}
 
-	return true, nil
+	return true, "", nil
 }
 
-func (r *AccessRequestReconciler) createRoleBinding(ctx context.Context, accessRequest *iamv1alpha1.AccessRequest) (ctrl.Result, error) {
+// approverAllowed returns whether the approval is allowed in the given namespace. Approvals made on
+// behalf of a delegator require the delegator to have delegated their approval rights to the user
+// when the approval was made and to be allowed to approve the accessrequest themselves
+func (r *AccessRequestReconciler) approverAllowed(ctx context.Context, accessRequest *iamv1alpha1.AccessRequest, approval iamv1alpha1.Approval, namespace string) (bool, error) {
+	if approval.Delegator != "" {
+		delegated, err := delegation.Delegated(ctx, r.Client, approval.Delegator, approval.User, approval.Time.Time)
+		if err != nil || !delegated {
+			return false, err
+		}
+	}
+
+	// Approvers may be allowed to approve through their groups, for example those that
+	// accessrequests are escalated to
+	sar, err := r.checkAccess(ctx, accessRequest, iamv1alpha1.Approver(approval), iamv1alpha1.ApproverUserInfo(approval), approveVerb, namespace)
+	if err != nil {
+		return false, err
+	}
+	return sar.Status.Allowed && !sar.Status.Denied, nil
+}
 
+// newRoleBinding returns the rolebinding that binds the given role in the given namespace for the
+// accessrequest
+func (r *AccessRequestReconciler) newRoleBinding(accessRequest *iamv1alpha1.AccessRequest, namespace string, roleRef rbacv1.RoleRef) (*rbacv1.RoleBinding, error) {
 	roleBinding := &rbacv1.RoleBinding{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      accessRequest.Name,
-			Namespace: accessRequest.Namespace,
-		},
-		Subjects: accessRequest.Spec.Subjects,
-		RoleRef:  accessRequest.Spec.RoleRef,
+		ObjectMeta: accessRequestObjectMeta(accessRequest, namespace, iamv1alpha1.RoleBindingName(accessRequest, namespace, roleRef)),
+		Subjects:   accessRequest.Spec.Subjects,
+		RoleRef:    roleRef,
 	}
-	if err := controllerutil.SetControllerReference(accessRequest, roleBinding, r.Scheme); err != nil {
-		return ctrl.Result{}, err
+	if err := r.setControllerReference(accessRequest, roleBinding); err != nil {
+		return nil, err
+	}
+	return roleBinding, nil
+}
+
+// newRole returns the role granting the rules of the accessrequest in the given namespace
+func (r *AccessRequestReconciler) newRole(accessRequest *iamv1alpha1.AccessRequest, namespace string) (*rbacv1.Role, error) {
+	role := &rbacv1.Role{
+		ObjectMeta: accessRequestObjectMeta(accessRequest, namespace, iamv1alpha1.InlineRoleRef(accessRequest).Name),
+		Rules:      accessRequest.Spec.Rules,
+	}
+	if err := r.setControllerReference(accessRequest, role); err != nil {
+		return nil, err
 	}
+	return role, nil
+}
 
-	return ctrl.Result{}, r.Create(ctx, roleBinding)
+// setControllerReference sets the accessrequest as the controller of the given object if they are
+// in the same namespace. Owner references cannot cross namespaces so objects in other namespaces
+// are only associated with the accessrequest through their labels and annotations
+func (r *AccessRequestReconciler) setControllerReference(accessRequest *iamv1alpha1.AccessRequest, object metav1.Object) error {
+	if object.GetNamespace() != accessRequest.Namespace {
+		return nil
+	}
+	return controllerutil.SetControllerReference(accessRequest, object, r.Scheme)
 }
 
 func (r *AccessRequestReconciler) reconcile(ctx context.Context, accessRequest *iamv1alpha1.AccessRequest) (ctrl.Result, error) {
-	log := r.Log.WithValues("accessrequest", fmt.Sprintf("%s/%s", accessRequest.Namespace, accessRequest.Name))
+	// Accessrequests that were closed without granting access keep their conditions until they are
+	// deleted
+	if reason := closedReason(accessRequest); reason != "" {
+		return r.reconcileClosed(ctx, reason, accessRequest)
+	}
 
 	// Default all conditions to unknown
 	// https://github.com/kubernetes/community/blob/master/contributors/devel/sig-architecture/api-conventions.md#typical-status-properties
 	accessRequest.Status.Conditions = setConditionStatus(accessRequest.Status.Conditions, iamv1alpha1.AccessRequestApproved, v1.ConditionUnknown, "", "")
 	accessRequest.Status.Conditions = setConditionStatus(accessRequest.Status.Conditions, iamv1alpha1.AccessRequestComplete, v1.ConditionUnknown, "", "")
+	if accessRequest.Spec.BreakGlass != nil {
+		accessRequest.Status.Conditions = setConditionStatus(accessRequest.Status.Conditions, iamv1alpha1.AccessRequestReviewed, v1.ConditionUnknown, "", "")
+	}
+
+	// Describe the granted permissions before approval so that approvers can assess them
+	if err := r.reconcileRisk(ctx, accessRequest); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Close accessrequests that have not been approved in time
+	pendingRequeueAfter, timedOut := r.reconcilePending(accessRequest)
+	if timedOut {
+		return r.reconcileClosed(ctx, "TimedOut", accessRequest)
+	}
+
+	approved, err := r.reconcileApproval(ctx, accessRequest)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if reason := closedReason(accessRequest); reason != "" {
+		return r.reconcileClosed(ctx, reason, accessRequest)
+	}
+
+	// Break-glass accessrequests grant access before approval so approval acts as a review
+	var reviewRequeueAfter time.Duration
+	if accessRequest.Spec.BreakGlass != nil {
+		reviewRequeueAfter = r.reconcileReview(accessRequest, approved)
+	}
+
+	// Revoke access once the accessrequest has expired
+	if isExpired(accessRequest) {
+		result, err := r.reconcileExpired(ctx, accessRequest)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if untilDeletion, ok := r.untilDeletion(accessRequest); ok {
+			result = requeueAfter(result, untilDeletion)
+			result.Requeue = untilDeletion <= 0
+		}
+		return requeueAfter(result, reviewRequeueAfter), nil
+	}
+
+	if !approved && accessRequest.Spec.BreakGlass == nil {
+		// Roles are approved again with the accessrequest
+		if accessRequest.Status.CompletionTime.IsZero() {
+			accessRequest.Status.ApprovedRoles = nil
+			accessRequest.Status.ApprovedRolesTime = nil
+		}
+		result := requeueAfter(ctrl.Result{}, pendingRequeueAfter)
+		if !accessRequest.Spec.Approved && accessRequest.Status.CompletionTime.IsZero() {
+			untilEscalation, err := r.reconcileEscalation(ctx, accessRequest)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			result = requeueAfter(result, untilEscalation)
+		}
+		return result, nil
+	}
+
+	// Record the rules of the referenced roles once the accessrequest is approved, before waiting
+	// for its start time, and suspend access while a role grants more than was approved
+	unapproved, err := r.reconcileApprovedRoles(ctx, accessRequest)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if unapproved != "" {
+		return requeueAfter(ctrl.Result{}, reviewRequeueAfter), r.suspendAccess(ctx, accessRequest, "RoleChanged", fmt.Sprintf("Access suspended because %s", unapproved))
+	}
+
+	// Wait until the start time before granting access
+	if startTime := accessRequest.Spec.StartTime; startTime != nil && accessRequest.Spec.BreakGlass == nil && accessRequest.Status.CompletionTime.IsZero() && time.Now().Before(startTime.Time) {
+		message := fmt.Sprintf("AccessRequest will be activated at %s", startTime.UTC().Format(time.RFC3339))
+		accessRequest.Status.Conditions = setConditionStatus(accessRequest.Status.Conditions, iamv1alpha1.AccessRequestComplete, v1.ConditionFalse, "WaitingForStartTime", message)
+		result := ctrl.Result{RequeueAfter: time.Until(startTime.Time)}
+		if expiry, ok := r.approvalExpiry(accessRequest); ok {
+			result = requeueAfter(result, time.Until(expiry))
+		}
+		return result, nil
+	}
+
+	result, err := r.reconcileRoleBindings(ctx, accessRequest)
+	return requeueAfter(result, reviewRequeueAfter), err
+}
+
+// reconcileApproval updates the approved condition and returns whether the accessrequest has been
+// approved by a user who is allowed to approve it
+func (r *AccessRequestReconciler) reconcileApproval(ctx context.Context, accessRequest *iamv1alpha1.AccessRequest) (bool, error) {
+	log := r.Log.WithValues("accessrequest", fmt.Sprintf("%s/%s", accessRequest.Namespace, accessRequest.Name))
 
 	// Check approval
+	requiredApprovals := iamv1alpha1.RequiredApprovals(accessRequest)
 	if !accessRequest.Spec.Approved {
-		accessRequest.Status.Conditions = setConditionStatus(accessRequest.Status.Conditions, iamv1alpha1.AccessRequestApproved, v1.ConditionFalse, "WaitingForApproval", "AccessRequest has not been approved")
-		return ctrl.Result{}, nil
+		message := "AccessRequest has not been approved"
+		if approvals := iamv1alpha1.Approvals(accessRequest); len(approvals) > 0 {
+			message = fmt.Sprintf("AccessRequest has %d of %d required approvals", len(approvals), requiredApprovals)
+		}
+		accessRequest.Status.Conditions = setConditionStatus(accessRequest.Status.Conditions, iamv1alpha1.AccessRequestApproved, v1.ConditionFalse, "WaitingForApproval", message)
+		return false, nil
 	}
 
 	// TODO: This situation should be ensured by the mutating admission webhook and verified by the
 	// validating admission webhook
 	if accessRequest.Spec.Attributes == nil || accessRequest.Spec.Attributes.ApprovedBy == "" {
-		return ctrl.Result{}, errors.New("accessrequest has been approved but the approvedBy attribute is not set")
+		return false, errors.New("accessrequest has been approved but the approvedBy attribute is not set")
 	}
-	accessRequest.Status.Conditions = setConditionStatus(accessRequest.Status.Conditions, iamv1alpha1.AccessRequestApproved, v1.ConditionTrue, "AccessRequestApproved", fmt.Sprintf("AccessRequest approved by %s", accessRequest.Spec.Attributes.ApprovedBy))
+	approvals := iamv1alpha1.Approvals(accessRequest)
+	if len(approvals) < requiredApprovals {
+		message := fmt.Sprintf("AccessRequest has %d of %d required approvals", len(approvals), requiredApprovals)
+		accessRequest.Status.Conditions = setConditionStatus(accessRequest.Status.Conditions, iamv1alpha1.AccessRequestApproved, v1.ConditionFalse, "WaitingForApproval", message)
+		log.Info(message)
+		return false, nil
+	}
+
+	// Accessrequests that are not activated soon enough after approval are rejected
+	if expiry, ok := r.approvalExpiry(accessRequest); ok && !time.Now().Before(expiry) {
+		message := fmt.Sprintf("Approval expired at %s before AccessRequest was activated", expiry.UTC().Format(time.RFC3339))
+		r.reject(accessRequest, "ApprovalExpired", message)
+		return false, nil
+	}
+	approvers := []string{}
+	for _, approval := range approvals {
+		approvers = append(approvers, delegation.Describe(approval))
+	}
+	accessRequest.Status.Conditions = setConditionStatus(accessRequest.Status.Conditions, iamv1alpha1.AccessRequestApproved, v1.ConditionTrue, "AccessRequestApproved", fmt.Sprintf("AccessRequest approved by %s", strings.Join(approvers, ", ")))
 
-	// Verify whether the user who approved the accessrequest is allowed to approve it. This should be
-	// validated by the validating webhook but we verify again to here to avoid TOCTOU race conditions
-	approvalAllowed, err := r.approvalAllowed(ctx, accessRequest)
+	// Verify whether the users who approved the accessrequest are allowed to approve it. This should
+	// be validated by the validating webhook but we verify again to here to avoid TOCTOU race
+	// conditions
+	approvalAllowed, approver, err := r.approvalAllowed(ctx, accessRequest)
 	if err != nil {
-		return ctrl.Result{}, err
+		return false, err
 	}
 	if !approvalAllowed {
-		message := fmt.Sprintf("%s is not allowed to approve AccessRequest", accessRequest.Spec.Attributes.ApprovedBy)
-		accessRequest.Status.Conditions = setConditionStatus(accessRequest.Status.Conditions, iamv1alpha1.AccessRequestComplete, v1.ConditionFalse, "ApproverDenied", message)
+		message := fmt.Sprintf("%s is not allowed to approve AccessRequest", approver)
 		log.Info(message)
-		return ctrl.Result{}, nil
+		// Accessrequests that have not granted access are rejected. Break-glass accessrequests grant
+		// access on behalf of the requester so remain until they expire or are revoked
+		if accessRequest.Spec.BreakGlass == nil && accessRequest.Status.CompletionTime.IsZero() {
+			r.reject(accessRequest, "ApproverDenied", message)
+			return false, nil
+		}
+		if accessRequest.Spec.BreakGlass != nil {
+			accessRequest.Status.Conditions = setConditionStatus(accessRequest.Status.Conditions, iamv1alpha1.AccessRequestComplete, v1.ConditionFalse, "ApproverDenied", message)
+			return false, nil
+		}
+		// Access granted by activated accessrequests is suspended until every approver is allowed
+		// again, for example because the approverdelegation they approved through was deleted
+		return false, r.suspendAccess(ctx, accessRequest, "ApproverDenied", fmt.Sprintf("Access suspended because %s", message))
 	}
 
-	// Get or create rolebinding
-	roleBinding := &rbacv1.RoleBinding{}
-	err = r.Get(ctx, types.NamespacedName{
-		Namespace: accessRequest.Namespace,
-		Name:      accessRequest.Name,
-	}, roleBinding)
+	return true, nil
+}
+
+// reject closes the accessrequest without granting access for the given reason. Rejected
+// accessrequests cannot be approved again and are deleted once their time to live has passed
+func (r *AccessRequestReconciler) reject(accessRequest *iamv1alpha1.AccessRequest, reason, message string) {
+	accessRequest.Status.Conditions = setConditionStatus(accessRequest.Status.Conditions, iamv1alpha1.AccessRequestApproved, v1.ConditionFalse, reason, message)
+	accessRequest.Status.Conditions = setConditionStatus(accessRequest.Status.Conditions, iamv1alpha1.AccessRequestComplete, v1.ConditionTrue, reason, message)
+	accessRequest.Status.Conditions = setConditionStatus(accessRequest.Status.Conditions, iamv1alpha1.AccessRequestRejected, v1.ConditionTrue, reason, message)
+	r.Recorder.Event(accessRequest, v1.EventTypeWarning, "Rejected", message)
+}
+
+// reconcileClosed archives an accessrequest that was closed without granting access, for the given
+// reason, and requeues it until it should be deleted
+func (r *AccessRequestReconciler) reconcileClosed(ctx context.Context, reason string, accessRequest *iamv1alpha1.AccessRequest) (ctrl.Result, error) {
+	if r.Archiver != nil && accessRequest.Status.ArchiveTime.IsZero() {
+		if err := r.archive(ctx, reason, accessRequest, nil); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	result := ctrl.Result{}
+	if untilDeletion, ok := r.untilDeletion(accessRequest); ok {
+		result = requeueAfter(result, untilDeletion)
+		result.Requeue = untilDeletion <= 0
+	}
+	return result, nil
+}
+
+// reconcilePending closes the accessrequest if it has not been approved within the pending time to
+// live and returns whether it has been closed or, if not, the duration after which
+// it should be checked again
+func (r *AccessRequestReconciler) reconcilePending(accessRequest *iamv1alpha1.AccessRequest) (time.Duration, bool) {
+	// Break-glass accessrequests are activated without approval and accessrequests that have been
+	// activated are no longer pending
+	if r.PendingTTL == 0 || accessRequest.Spec.Approved || accessRequest.Spec.BreakGlass != nil || !accessRequest.Status.CompletionTime.IsZero() {
+		return 0, false
+	}
+	deadline := accessRequest.CreationTimestamp.Add(r.PendingTTL)
+	if time.Now().Before(deadline) {
+		return time.Until(deadline), false
+	}
+
+	message := fmt.Sprintf("AccessRequest was not approved within %s", r.PendingTTL)
+	accessRequest.Status.Conditions = setConditionStatus(accessRequest.Status.Conditions, iamv1alpha1.AccessRequestApproved, v1.ConditionFalse, "TimedOut", message)
+	accessRequest.Status.Conditions = setConditionStatus(accessRequest.Status.Conditions, iamv1alpha1.AccessRequestComplete, v1.ConditionTrue, "TimedOut", message)
+	accessRequest.Status.Conditions = setConditionStatus(accessRequest.Status.Conditions, iamv1alpha1.AccessRequestExpired, v1.ConditionTrue, "TimedOut", message)
+	r.Recorder.Event(accessRequest, v1.EventTypeNormal, "TimedOut", message)
+	r.Log.Info(message, "accessrequest", fmt.Sprintf("%s/%s", accessRequest.Namespace, accessRequest.Name))
+	return 0, true
+}
+
+// approvalExpiry returns the time at which the approval of the accessrequest expires and whether
+// it expires at all. Only approvals of accessrequests that have not been activated expire
+func (r *AccessRequestReconciler) approvalExpiry(accessRequest *iamv1alpha1.AccessRequest) (time.Time, bool) {
+	approvalTime := approvalTime(accessRequest)
+	if r.ApprovalValidity == 0 || approvalTime == nil || accessRequest.Spec.BreakGlass != nil || !accessRequest.Status.CompletionTime.IsZero() {
+		return time.Time{}, false
+	}
+	return approvalTime.Add(r.ApprovalValidity), true
+}
+
+// reconcileRisk records the risk score of the permissions granted by the accessrequest and a
+// summary of its rules. Referenced roles that do not exist are reported as missing since they may
+// be created later
+func (r *AccessRequestReconciler) reconcileRisk(ctx context.Context, accessRequest *iamv1alpha1.AccessRequest) error {
+	findings := []rules.Finding{}
+	summary := []string{}
+	for _, roleRef := range iamv1alpha1.RoleRefs(accessRequest) {
+		description := fmt.Sprintf("%s %s", roleRef.Kind, roleRef.Name)
+		if roleRef == iamv1alpha1.InlineRoleRef(accessRequest) {
+			description = "Rules"
+		}
+
+		policyRules, found, err := r.getRoleRules(ctx, accessRequest, accessRequest.Namespace, roleRef)
+		if err != nil {
+			return err
+		}
+		if !found {
+			summary = append(summary, fmt.Sprintf("%s: not found", description))
+			continue
+		}
+		findings = append(findings, rules.Analyze(policyRules)...)
+		for _, rule := range rules.Summarize(policyRules) {
+			summary = append(summary, fmt.Sprintf("%s: %s", description, rule))
+		}
+	}
+
+	risks := []string{}
+	seen := map[rules.Risk]bool{}
+	for _, finding := range findings {
+		if !seen[finding.Risk] {
+			seen[finding.Risk] = true
+			risks = append(risks, string(finding.Risk))
+		}
+	}
+	accessRequest.Status.Risk = &iamv1alpha1.RiskStatus{
+		Score:   int32(rules.Score(findings)),
+		Risks:   risks,
+		Summary: summary,
+	}
+	return nil
+}
+
+// getRoleRules returns the rules granted by the referenced role in the given namespace and whether
+// the role exists
+func (r *AccessRequestReconciler) getRoleRules(ctx context.Context, accessRequest *iamv1alpha1.AccessRequest, namespace string, roleRef rbacv1.RoleRef) ([]rbacv1.PolicyRule, bool, error) {
+	// The role granting the rules of the accessrequest does not exist until access is granted
+	if roleRef == iamv1alpha1.InlineRoleRef(accessRequest) {
+		return accessRequest.Spec.Rules, true, nil
+	}
+
+	var err error
+	var policyRules []rbacv1.PolicyRule
+	switch roleRef.Kind {
+	case "ClusterRole":
+		clusterRole := &rbacv1.ClusterRole{}
+		err = r.Get(ctx, types.NamespacedName{Name: roleRef.Name}, clusterRole)
+		policyRules = clusterRole.Rules
+	case "Role":
+		role := &rbacv1.Role{}
+		err = r.Get(ctx, types.NamespacedName{Namespace: namespace, Name: roleRef.Name}, role)
+		policyRules = role.Rules
+	default:
+		return nil, false, nil
+	}
 	if k8serrors.IsNotFound(err) {
-		return r.createRoleBinding(ctx, accessRequest)
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return policyRules, true, nil
+}
+
+// reconcileReview updates the reviewed condition of a break-glass accessrequest, escalating if the
+// review deadline has passed, and returns the duration after which the review should be checked
+// again
+func (r *AccessRequestReconciler) reconcileReview(accessRequest *iamv1alpha1.AccessRequest, reviewed bool) time.Duration {
+	log := r.Log.WithValues("accessrequest", fmt.Sprintf("%s/%s", accessRequest.Namespace, accessRequest.Name))
+
+	if reviewed {
+		accessRequest.Status.Conditions = setConditionStatus(accessRequest.Status.Conditions, iamv1alpha1.AccessRequestReviewed, v1.ConditionTrue, "AccessRequestReviewed", fmt.Sprintf("AccessRequest reviewed by %s", accessRequest.Spec.Attributes.ApprovedBy))
+		return 0
+	}
+
+	// Start the review period
+	if accessRequest.Status.ReviewDeadline.IsZero() {
+		reviewDeadline := metav1.NewTime(time.Now().Add(r.ReviewPeriod))
+		accessRequest.Status.ReviewDeadline = &reviewDeadline
+	}
+
+	untilReviewDeadline := time.Until(accessRequest.Status.ReviewDeadline.Time)
+	if untilReviewDeadline > 0 {
+		accessRequest.Status.Conditions = setConditionStatus(accessRequest.Status.Conditions, iamv1alpha1.AccessRequestReviewed, v1.ConditionFalse, "PendingReview", fmt.Sprintf("AccessRequest must be reviewed by an approver before %s", accessRequest.Status.ReviewDeadline.UTC().Format(time.RFC3339)))
+		return untilReviewDeadline
+	}
+
+	message := fmt.Sprintf("AccessRequest was not reviewed by an approver before %s", accessRequest.Status.ReviewDeadline.UTC().Format(time.RFC3339))
+	accessRequest.Status.Conditions = setConditionStatus(accessRequest.Status.Conditions, iamv1alpha1.AccessRequestReviewed, v1.ConditionFalse, "ReviewOverdue", message)
+	r.Recorder.Event(accessRequest, v1.EventTypeWarning, "ReviewOverdue", message)
+	log.Info(message)
+
+	return r.ReviewReminderInterval
+}
+
+// reconcileRoleBindings ensures a rolebinding granting access exists for each role referenced by
+// the accessrequest in each of its namespaces. Missing rolebindings are only created once all of
+// them can be so that access is granted atomically
+func (r *AccessRequestReconciler) reconcileRoleBindings(ctx context.Context, accessRequest *iamv1alpha1.AccessRequest) (ctrl.Result, error) {
+	log := r.Log.WithValues("accessrequest", fmt.Sprintf("%s/%s", accessRequest.Namespace, accessRequest.Name))
+
+	roleRefs := iamv1alpha1.RoleRefs(accessRequest)
+	if len(roleRefs) == 0 {
+		accessRequest.Status.Conditions = setConditionStatus(accessRequest.Status.Conditions, iamv1alpha1.AccessRequestComplete, v1.ConditionFalse, "RoleRefMissing", "AccessRequest does not reference any roles")
+		return ctrl.Result{}, nil
+	}
+
+	namespaceList := &v1.NamespaceList{}
+	if err := r.List(ctx, namespaceList); err != nil {
+		return ctrl.Result{}, err
+	}
+	namespaces, missingNamespaces, err := iamv1alpha1.TargetNamespaces(accessRequest, namespaceList.Items)
+	if err != nil {
+		accessRequest.Status.Conditions = setConditionStatus(accessRequest.Status.Conditions, iamv1alpha1.AccessRequestComplete, v1.ConditionFalse, "InvalidNamespaceSelector", fmt.Sprintf("AccessRequest namespaceSelector is invalid: %v", err))
+		return ctrl.Result{}, nil
+	}
+
+	// Get rolebindings
+	statuses := []iamv1alpha1.RoleBindingStatus{}
+	conflict := false
+	desiredRoleBindings := map[types.NamespacedName]bool{}
+	missingRoleBindings := []*rbacv1.RoleBinding{}
+	desiredRoles := map[types.NamespacedName]bool{}
+	missingRoles := []*rbacv1.Role{}
+	for _, namespace := range namespaces {
+		// The approver must be allowed to approve accessrequests in every namespace that access is
+		// granted in
+		allowed, message, err := r.namespaceAllowed(ctx, accessRequest, namespace)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+
+		// Rules are granted through a role created for the accessrequest in each namespace
+		if allowed && len(accessRequest.Spec.Rules) > 0 {
+			role, err := r.newRole(accessRequest, namespace)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			desiredRoles[types.NamespacedName{Namespace: role.Namespace, Name: role.Name}] = true
+
+			existingRole := &rbacv1.Role{}
+			err = r.Get(ctx, types.NamespacedName{
+				Namespace: role.Namespace,
+				Name:      role.Name,
+			}, existingRole)
+			switch {
+			case k8serrors.IsNotFound(err):
+				missingRoles = append(missingRoles, role)
+			case err != nil:
+				return ctrl.Result{}, err
+			case !isControlledBy(existingRole, accessRequest):
+				message := fmt.Sprintf("Role %s/%s exists but is not controlled by AccessRequest", role.Namespace, role.Name)
+				accessRequest.Status.Conditions = setConditionStatus(accessRequest.Status.Conditions, iamv1alpha1.AccessRequestComplete, v1.ConditionFalse, "RoleExists", message)
+				conflict = true
+			case !equality.Semantic.DeepEqual(existingRole.Rules, role.Rules):
+				// Users who can update roles in the namespace may have changed the role to grant more
+				// than the approved rules so it is reset to them
+				existingRole.Rules = role.Rules
+				if err := r.Update(ctx, existingRole); err != nil {
+					return ctrl.Result{}, err
+				}
+				message := fmt.Sprintf("Role %s/%s reset to the rules of AccessRequest", role.Namespace, role.Name)
+				r.Recorder.Event(accessRequest, v1.EventTypeWarning, "RoleReset", message)
+				log.Info(message)
+			}
+		}
+
+		for _, roleRef := range roleRefs {
+			roleBinding, err := r.newRoleBinding(accessRequest, namespace, roleRef)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			status := iamv1alpha1.RoleBindingStatus{
+				Name:      roleBinding.Name,
+				Namespace: roleBinding.Namespace,
+				RoleRef:   roleRef,
+			}
+			if !allowed {
+				status.Message = message
+				statuses = append(statuses, status)
+				continue
+			}
+			desiredRoleBindings[types.NamespacedName{Namespace: roleBinding.Namespace, Name: roleBinding.Name}] = true
+
+			existingRoleBinding := &rbacv1.RoleBinding{}
+			err = r.Get(ctx, types.NamespacedName{
+				Namespace: roleBinding.Namespace,
+				Name:      roleBinding.Name,
+			}, existingRoleBinding)
+			switch {
+			case k8serrors.IsNotFound(err):
+				status.Message = "RoleBinding has not been created"
+				missingRoleBindings = append(missingRoleBindings, roleBinding)
+			case err != nil:
+				return ctrl.Result{}, err
+			default:
+				// Check rolebinding is controlled by accessrequest
+				if !isControlledBy(existingRoleBinding, accessRequest) {
+					status.Message = fmt.Sprintf("RoleBinding %s/%s exists but is not controlled by AccessRequest", roleBinding.Namespace, roleBinding.Name)
+					accessRequest.Status.Conditions = setConditionStatus(accessRequest.Status.Conditions, iamv1alpha1.AccessRequestComplete, v1.ConditionFalse, "RoleBindingExists", status.Message)
+					conflict = true
+				} else {
+					status.Bound = true
+				}
+			}
+			statuses = append(statuses, status)
+		}
+	}
+	for _, namespace := range missingNamespaces {
+		for _, roleRef := range roleRefs {
+			statuses = append(statuses, iamv1alpha1.RoleBindingStatus{
+				Name:      iamv1alpha1.RoleBindingName(accessRequest, namespace, roleRef),
+				Namespace: namespace,
+				RoleRef:   roleRef,
+				Message:   fmt.Sprintf("Namespace %s not found", namespace),
+			})
+		}
+	}
+	accessRequest.Status.RoleBindings = statuses
+	if conflict {
+		return ctrl.Result{}, nil
+	}
+
+	// Check that the apiserver accepts every missing role and rolebinding, for example that the
+	// controller is allowed to grant the rules and bind each role, before creating any of them
+	for _, role := range missingRoles {
+		if err := r.Create(ctx, role.DeepCopy(), client.DryRunAll); err != nil {
+			r.setRoleCreateFailed(accessRequest, role, err)
+			return ctrl.Result{}, err
+		}
+	}
+	for _, roleBinding := range missingRoleBindings {
+		if err := r.Create(ctx, roleBinding.DeepCopy(), client.DryRunAll); err != nil {
+			r.setRoleBindingCreateFailed(accessRequest, roleBinding, err)
+			return ctrl.Result{}, err
+		}
+	}
+	for _, role := range missingRoles {
+		if err := r.Create(ctx, role); err != nil {
+			r.setRoleCreateFailed(accessRequest, role, err)
+			return ctrl.Result{}, err
+		}
+	}
+	for _, roleBinding := range missingRoleBindings {
+		if err := r.Create(ctx, roleBinding); err != nil {
+			r.setRoleBindingCreateFailed(accessRequest, roleBinding, err)
+			return ctrl.Result{}, err
+		}
+		for i := range accessRequest.Status.RoleBindings {
+			status := &accessRequest.Status.RoleBindings[i]
+			if status.Namespace == roleBinding.Namespace && status.Name == roleBinding.Name {
+				status.Bound = true
+				status.Message = ""
+			}
+		}
+	}
+
+	// Revoke access in namespaces that access is no longer granted in, for example because they no
+	// longer match the namespace selector
+	controlledRoleBindings, err := r.getControlledRoleBindings(ctx, accessRequest)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	staleRoleBindings := []rbacv1.RoleBinding{}
+	for _, roleBinding := range controlledRoleBindings {
+		if !desiredRoleBindings[types.NamespacedName{Namespace: roleBinding.Namespace, Name: roleBinding.Name}] {
+			staleRoleBindings = append(staleRoleBindings, roleBinding)
+		}
+	}
+	if err := r.deleteRoleBindings(ctx, log, accessRequest, staleRoleBindings); err != nil {
+		return ctrl.Result{}, err
 	}
+	controlledRoles, err := r.getControlledRoles(ctx, accessRequest)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
+	staleRoles := []rbacv1.Role{}
+	for _, role := range controlledRoles {
+		if !desiredRoles[types.NamespacedName{Namespace: role.Namespace, Name: role.Name}] {
+			staleRoles = append(staleRoles, role)
+		}
+	}
+	if err := r.deleteRoles(ctx, log, accessRequest, staleRoles); err != nil {
+		return ctrl.Result{}, err
+	}
 
-	// Check rolebinding is controlled by accessrequest
-	ref := metav1.GetControllerOf(roleBinding)
-	if ref == nil || ref.UID != accessRequest.UID {
-		accessRequest.Status.Conditions = setConditionStatus(accessRequest.Status.Conditions, iamv1alpha1.AccessRequestComplete, v1.ConditionFalse, "RoleBindingExists", fmt.Sprintf("RoleBinding %s exists but is not controlled by AccessRequest", roleBinding.Name))
+	// Namespaces matching the namespace selector may be created later
+	if !anyBound(accessRequest.Status.RoleBindings) {
+		accessRequest.Status.Conditions = setConditionStatus(accessRequest.Status.Conditions, iamv1alpha1.AccessRequestComplete, v1.ConditionFalse, "NamespaceMissing", "AccessRequest does not grant access in any existing namespace")
 		return ctrl.Result{}, nil
 	}
 
-	// TODO: check rolebinding matches accessrequest specification
+	// TODO: check rolebindings match accessrequest specification
 
 	// Set completion time
 	if accessRequest.Status.CompletionTime.IsZero() {
@@ -177,15 +752,589 @@ func (r *AccessRequestReconciler) reconcile(ctx context.Context, accessRequest *
 		accessRequest.Status.CompletionTime = &currentTime
 	}
 
-	accessRequest.Status.Conditions = setConditionStatus(accessRequest.Status.Conditions, iamv1alpha1.AccessRequestComplete, v1.ConditionTrue, "RoleBindingCreated", fmt.Sprintf("RoleBinding %s created", accessRequest.Name))
+	accessRequest.Status.Conditions = setConditionStatus(accessRequest.Status.Conditions, iamv1alpha1.AccessRequestComplete, v1.ConditionTrue, "RoleBindingCreated", roleBindingsCreatedMessage(accessRequest))
+
+	// Set expiration time for time-bound accessrequests
+	duration := r.grantDuration(accessRequest)
+	if duration == 0 {
+		return ctrl.Result{}, nil
+	}
+	extension, err := r.extensionDuration(ctx, accessRequest)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	expirationTime := metav1.NewTime(accessRequest.Status.CompletionTime.Add(duration + extension))
+	switch {
+	case accessRequest.Status.ExpirationTime.IsZero():
+		accessRequest.Status.ExpirationTime = &expirationTime
+	case extension > 0 && expirationTime.After(accessRequest.Status.ExpirationTime.Time):
+		// Only approved extensions move the expiration time later, which they do without recreating
+		// the rolebindings
+		message := fmt.Sprintf("AccessRequest extended until %s", expirationTime.UTC().Format(time.RFC3339))
+		r.Recorder.Event(accessRequest, v1.EventTypeNormal, "AccessRequestExtended", message)
+		log.Info(message)
+		accessRequest.Status.ExpirationTime = &expirationTime
+	}
+
+	return ctrl.Result{RequeueAfter: time.Until(accessRequest.Status.ExpirationTime.Time)}, nil
+}
+
+// extensionDuration returns the additional time granted by the approved extensions of the
+// accessrequest. As with the accessrequest, approvers are verified again to avoid TOCTOU race
+// conditions
+func (r *AccessRequestReconciler) extensionDuration(ctx context.Context, accessRequest *iamv1alpha1.AccessRequest) (time.Duration, error) {
+	log := r.Log.WithValues("accessrequest", fmt.Sprintf("%s/%s", accessRequest.Namespace, accessRequest.Name))
+
+	var duration time.Duration
+	for i := range accessRequest.Spec.Extensions {
+		extension := &accessRequest.Spec.Extensions[i]
+		approvals := iamv1alpha1.ExtensionApprovals(extension)
+		if !extension.Approved || len(approvals) < iamv1alpha1.RequiredApprovals(accessRequest) {
+			continue
+		}
+
+		allowed := true
+		for _, approval := range approvals {
+			approverAllowed, err := r.approverAllowed(ctx, accessRequest, approval, accessRequest.Namespace)
+			if err != nil {
+				return 0, err
+			}
+			if !approverAllowed {
+				log.Info(fmt.Sprintf("%s is not allowed to approve extension %d of AccessRequest", delegation.Describe(approval), i))
+				allowed = false
+				break
+			}
+		}
+		if allowed {
+			duration += extension.Duration.Duration
+		}
+	}
+	return duration, nil
+}
+
+// reconcileApprovedRoles records the rules of each role referenced by the accessrequest in each of
+// its namespaces once it has been approved and describes the roles that grant more than was
+// approved, or an empty string if there are none. Roles that are changed to grant more than was
+// recorded are not approved and nor are roles that did not exist when the rules were recorded,
+// including roles in namespaces selected later
+func (r *AccessRequestReconciler) reconcileApprovedRoles(ctx context.Context, accessRequest *iamv1alpha1.AccessRequest) (string, error) {
+	namespaceList := &v1.NamespaceList{}
+	if err := r.List(ctx, namespaceList); err != nil {
+		return "", err
+	}
+	// An invalid namespace selector is reported when granting access
+	namespaces, _, err := iamv1alpha1.TargetNamespaces(accessRequest, namespaceList.Items)
+	if err != nil {
+		return "", nil
+	}
+
+	// Accessrequests that recorded roles before the recording time was introduced stop recording now
+	recording := accessRequest.Status.ApprovedRolesTime == nil && len(accessRequest.Status.ApprovedRoles) == 0
+	changedRoles, unrecordedRoles := []string{}, []string{}
+	for _, roleRef := range iamv1alpha1.RoleRefs(accessRequest) {
+		// The role created for the rules of the accessrequest is reset to them whenever it is changed
+		if roleRef == iamv1alpha1.InlineRoleRef(accessRequest) {
+			continue
+		}
+		roleNamespaces := namespaces
+		if roleRef.Kind == "ClusterRole" {
+			roleNamespaces = []string{""}
+		}
+
+		for _, namespace := range roleNamespaces {
+			policyRules, found, err := r.getRoleRules(ctx, accessRequest, namespace, roleRef)
+			if err != nil {
+				return "", err
+			}
+			hash := rules.Hash(policyRules)
+
+			approvedRole := getApprovedRole(accessRequest, namespace, roleRef)
+			if approvedRole == nil {
+				if !found {
+					continue
+				}
+				if !recording {
+					unrecordedRoles = append(unrecordedRoles, describeRole(namespace, roleRef))
+					continue
+				}
+				accessRequest.Status.ApprovedRoles = append(accessRequest.Status.ApprovedRoles, iamv1alpha1.ApprovedRole{
+					Namespace: namespace,
+					RoleRef:   roleRef,
+					Hash:      hash,
+					Rules:     policyRules,
+				})
+				continue
+			}
+
+			// Roles may be changed to grant less than was approved
+			if approvedRole.Hash == hash || rules.Covers(approvedRole.Rules, policyRules) {
+				continue
+			}
+			changedRoles = append(changedRoles, describeRole(namespace, roleRef))
+		}
+	}
+	if accessRequest.Status.ApprovedRolesTime == nil {
+		now := metav1.Now()
+		accessRequest.Status.ApprovedRolesTime = &now
+	}
+
+	messages := []string{}
+	reason := "RoleBroadened"
+	if len(changedRoles) > 0 {
+		messages = append(messages, fmt.Sprintf("%s changed to grant more than was approved", strings.Join(changedRoles, ", ")))
+	}
+	if len(unrecordedRoles) > 0 {
+		messages = append(messages, fmt.Sprintf("%s did not exist when the AccessRequest was approved", strings.Join(unrecordedRoles, ", ")))
+		if len(changedRoles) == 0 {
+			reason = "RoleNotApproved"
+		}
+	}
+	if len(messages) > 0 {
+		message := strings.Join(messages, " and ")
+		accessRequest.Status.Conditions = setConditionStatus(accessRequest.Status.Conditions, iamv1alpha1.AccessRequestRoleChanged, v1.ConditionTrue, reason, message)
+		return message, nil
+	}
+	accessRequest.Status.Conditions = setConditionStatus(accessRequest.Status.Conditions, iamv1alpha1.AccessRequestRoleChanged, v1.ConditionFalse, "RolesUnchanged", "Roles grant no more than was approved")
+	return "", nil
+}
+
+// describeRole returns the kind and name of the referenced role in the given namespace
+func describeRole(namespace string, roleRef rbacv1.RoleRef) string {
+	if namespace == "" {
+		return fmt.Sprintf("%s %s", roleRef.Kind, roleRef.Name)
+	}
+	return fmt.Sprintf("%s %s/%s", roleRef.Kind, namespace, roleRef.Name)
+}
+
+// suspendAccess revokes access granted by the accessrequest for the given reason. Access is granted
+// again once the reason no longer applies
+func (r *AccessRequestReconciler) suspendAccess(ctx context.Context, accessRequest *iamv1alpha1.AccessRequest, reason, message string) error {
+	log := r.Log.WithValues("accessrequest", fmt.Sprintf("%s/%s", accessRequest.Namespace, accessRequest.Name))
+
+	roleBindings, err := r.getControlledRoleBindings(ctx, accessRequest)
+	if err != nil {
+		return err
+	}
+	if err := r.deleteRoleBindings(ctx, log, accessRequest, roleBindings); err != nil {
+		return err
+	}
+
+	for i := range accessRequest.Status.RoleBindings {
+		accessRequest.Status.RoleBindings[i].Bound = false
+		accessRequest.Status.RoleBindings[i].Message = message
+	}
+	if condition := getCondition(accessRequest.Status.Conditions, iamv1alpha1.AccessRequestComplete); condition == nil || condition.Reason != reason {
+		r.Recorder.Event(accessRequest, v1.EventTypeWarning, reason, message)
+		log.Info(message)
+	}
+	accessRequest.Status.Conditions = setConditionStatus(accessRequest.Status.Conditions, iamv1alpha1.AccessRequestComplete, v1.ConditionFalse, reason, message)
+	return nil
+}
+
+// getApprovedRole returns the rules recorded for the referenced role in the given namespace or nil
+// if they have not been recorded
+func getApprovedRole(accessRequest *iamv1alpha1.AccessRequest, namespace string, roleRef rbacv1.RoleRef) *iamv1alpha1.ApprovedRole {
+	for i := range accessRequest.Status.ApprovedRoles {
+		approvedRole := &accessRequest.Status.ApprovedRoles[i]
+		if approvedRole.Namespace == namespace && approvedRole.RoleRef == roleRef {
+			return approvedRole
+		}
+	}
+	return nil
+}
+
+// namespaceAllowed returns whether access may be granted in the given namespace and, if not, why.
+// Approved accessrequests require every approver to be allowed to approve accessrequests in the
+// namespace. Break-glass accessrequests are granted on behalf of the requester, whether or not they
+// have been reviewed, so require the requester to be allowed to break glass there. As with
+// approvers, this is verified again in the namespace of the accessrequest to avoid TOCTOU race
+// conditions
+func (r *AccessRequestReconciler) namespaceAllowed(ctx context.Context, accessRequest *iamv1alpha1.AccessRequest, namespace string) (bool, string, error) {
+	if accessRequest.Spec.Attributes == nil {
+		return false, "", errors.New("accessrequest attributes are not set")
+	}
+
+	if accessRequest.Spec.BreakGlass != nil {
+		// The requester may be allowed to break glass through their groups
+		user := accessRequest.Spec.Attributes.CreatedBy
+		sar, err := r.checkAccess(ctx, accessRequest, user, accessRequest.Spec.Attributes.CreatedByUserInfo, breakGlassVerb, namespace)
+		if err != nil {
+			return false, "", err
+		}
+		if !sar.Status.Allowed || sar.Status.Denied {
+			return false, fmt.Sprintf("%s is not allowed to %s AccessRequests in namespace %s", user, breakGlassVerb, namespace), nil
+		}
+		return true, "", nil
+	}
+
+	// Approvers have already been verified in the namespace of the accessrequest
+	if namespace == accessRequest.Namespace {
+		return true, "", nil
+	}
+	for _, approval := range iamv1alpha1.Approvals(accessRequest) {
+		allowed, err := r.approverAllowed(ctx, accessRequest, approval, namespace)
+		if err != nil {
+			return false, "", err
+		}
+		if !allowed {
+			return false, fmt.Sprintf("%s is not allowed to %s AccessRequests in namespace %s", delegation.Describe(approval), approveVerb, namespace), nil
+		}
+	}
+	return true, "", nil
+}
+
+// setRoleCreateFailed records that the given role could not be created
+func (r *AccessRequestReconciler) setRoleCreateFailed(accessRequest *iamv1alpha1.AccessRequest, role *rbacv1.Role, err error) {
+	message := fmt.Sprintf("Role %s/%s could not be created: %v", role.Namespace, role.Name, err)
+	accessRequest.Status.Conditions = setConditionStatus(accessRequest.Status.Conditions, iamv1alpha1.AccessRequestComplete, v1.ConditionFalse, "RoleFailed", message)
+}
+
+// setRoleBindingCreateFailed records that the given rolebinding could not be created
+func (r *AccessRequestReconciler) setRoleBindingCreateFailed(accessRequest *iamv1alpha1.AccessRequest, roleBinding *rbacv1.RoleBinding, err error) {
+	message := fmt.Sprintf("RoleBinding %s/%s could not be created: %v", roleBinding.Namespace, roleBinding.Name, err)
+	for i := range accessRequest.Status.RoleBindings {
+		status := &accessRequest.Status.RoleBindings[i]
+		if status.Namespace == roleBinding.Namespace && status.Name == roleBinding.Name {
+			status.Message = message
+		}
+	}
+	accessRequest.Status.Conditions = setConditionStatus(accessRequest.Status.Conditions, iamv1alpha1.AccessRequestComplete, v1.ConditionFalse, "RoleBindingFailed", message)
+}
+
+// reconcileExpired ensures the rolebinding granting access has been deleted
+func (r *AccessRequestReconciler) reconcileExpired(ctx context.Context, accessRequest *iamv1alpha1.AccessRequest) (ctrl.Result, error) {
+	log := r.Log.WithValues("accessrequest", fmt.Sprintf("%s/%s", accessRequest.Namespace, accessRequest.Name))
+
+	roleBindings, err := r.getControlledRoleBindings(ctx, accessRequest)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	message := fmt.Sprintf("AccessRequest expired at %s", accessRequest.Status.ExpirationTime.UTC().Format(time.RFC3339))
+
+	// Archive the accessrequest in its final state before revoking access so that the record
+	// includes the rolebindings
+	if r.Archiver != nil && accessRequest.Status.ArchiveTime.IsZero() {
+		finishedAccessRequest := accessRequest.DeepCopy()
+		finishedAccessRequest.Status.Conditions = setConditionStatus(finishedAccessRequest.Status.Conditions, iamv1alpha1.AccessRequestComplete, v1.ConditionTrue, "AccessRequestExpired", message)
+		finishedAccessRequest.Status.Conditions = setConditionStatus(finishedAccessRequest.Status.Conditions, iamv1alpha1.AccessRequestExpired, v1.ConditionTrue, "AccessRequestExpired", message)
+		if err := r.archive(ctx, "Expired", finishedAccessRequest, roleBindings); err != nil {
+			return ctrl.Result{}, err
+		}
+		accessRequest.Status.ArchiveTime = finishedAccessRequest.Status.ArchiveTime
+	}
+
+	if err := r.deleteRoleBindings(ctx, log, accessRequest, roleBindings); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.deleteControlledRoles(ctx, log, accessRequest); err != nil {
+		return ctrl.Result{}, err
+	}
+	for i := range accessRequest.Status.RoleBindings {
+		accessRequest.Status.RoleBindings[i].Bound = false
+		accessRequest.Status.RoleBindings[i].Message = "RoleBinding deleted because AccessRequest expired"
+	}
+
+	accessRequest.Status.Conditions = setConditionStatus(accessRequest.Status.Conditions, iamv1alpha1.AccessRequestComplete, v1.ConditionTrue, "AccessRequestExpired", message)
+	accessRequest.Status.Conditions = setConditionStatus(accessRequest.Status.Conditions, iamv1alpha1.AccessRequestExpired, v1.ConditionTrue, "AccessRequestExpired", message)
+
+	return ctrl.Result{}, nil
+}
+
+// reconcileDelete revokes access granted by a deleted accessrequest before releasing the
+// finalizer. Who deleted it is recorded in the audit log by the validating webhook. The status of the accessrequest must not be modified because it
+// may be removed as soon as the finalizer is released
+func (r *AccessRequestReconciler) reconcileDelete(ctx context.Context, accessRequest *iamv1alpha1.AccessRequest) (ctrl.Result, error) {
+	log := r.Log.WithValues("accessrequest", fmt.Sprintf("%s/%s", accessRequest.Namespace, accessRequest.Name))
+
+	if !controllerutil.ContainsFinalizer(accessRequest, accessRequestFinalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	roleBindings, err := r.getControlledRoleBindings(ctx, accessRequest)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Archive the accessrequest before revoking access so that the record includes the rolebindings.
+	// Finished accessrequests, such as those deleted once their TTL has passed, have already been
+	// archived
+	if r.Archiver != nil && accessRequest.Status.ArchiveTime.IsZero() {
+		if err := r.Archiver.Write(ctx, archive.NewRecord("Deleted", accessRequest, roleBindings)); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to archive accessrequest: %v", err)
+		}
+	}
+
+	if err := r.deleteRoleBindings(ctx, log, accessRequest, roleBindings); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.deleteControlledRoles(ctx, log, accessRequest); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	message := "AccessRequest deleted so access has been revoked"
+	r.Recorder.Event(accessRequest, v1.EventTypeNormal, "AccessRequestDeleted", message)
+	log.Info(message)
+
+	controllerutil.RemoveFinalizer(accessRequest, accessRequestFinalizer)
 
 	return ctrl.Result{}, nil
 }
 
+// getControlledRoleBindings returns the rolebindings controlled by the accessrequest in any
+// namespace
+func (r *AccessRequestReconciler) getControlledRoleBindings(ctx context.Context, accessRequest *iamv1alpha1.AccessRequest) ([]rbacv1.RoleBinding, error) {
+	roleBindingList := &rbacv1.RoleBindingList{}
+	if err := r.List(ctx, roleBindingList, client.MatchingLabels{
+		iamv1alpha1.AccessRequestUIDLabel: string(accessRequest.UID),
+	}); err != nil {
+		return nil, err
+	}
+
+	// Rolebindings created by earlier versions of the controller are named after the accessrequest
+	// and are not labelled
+	legacyRoleBinding := rbacv1.RoleBinding{}
+	err := r.Get(ctx, types.NamespacedName{
+		Namespace: accessRequest.Namespace,
+		Name:      accessRequest.Name,
+	}, &legacyRoleBinding)
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return nil, err
+	}
+	if err == nil && legacyRoleBinding.Labels[iamv1alpha1.AccessRequestUIDLabel] == "" {
+		roleBindingList.Items = append(roleBindingList.Items, legacyRoleBinding)
+	}
+
+	roleBindings := []rbacv1.RoleBinding{}
+	for i := range roleBindingList.Items {
+		if isControlledBy(&roleBindingList.Items[i], accessRequest) {
+			roleBindings = append(roleBindings, roleBindingList.Items[i])
+		}
+	}
+	return roleBindings, nil
+}
+
+// deleteRoleBindings deletes the given rolebindings controlled by the accessrequest
+func (r *AccessRequestReconciler) deleteRoleBindings(ctx context.Context, log logr.Logger, accessRequest *iamv1alpha1.AccessRequest, roleBindings []rbacv1.RoleBinding) error {
+	for i := range roleBindings {
+		if err := r.Delete(ctx, &roleBindings[i]); err != nil && !k8serrors.IsNotFound(err) {
+			return err
+		}
+		message := fmt.Sprintf("RoleBinding %s/%s deleted", roleBindings[i].Namespace, roleBindings[i].Name)
+		r.Recorder.Event(accessRequest, v1.EventTypeNormal, "RoleBindingDeleted", message)
+		log.Info(message)
+	}
+	return nil
+}
+
+// getControlledRoles returns the roles created for the rules of the accessrequest in any namespace
+func (r *AccessRequestReconciler) getControlledRoles(ctx context.Context, accessRequest *iamv1alpha1.AccessRequest) ([]rbacv1.Role, error) {
+	roleList := &rbacv1.RoleList{}
+	if err := r.List(ctx, roleList, client.MatchingLabels{
+		iamv1alpha1.AccessRequestUIDLabel: string(accessRequest.UID),
+	}); err != nil {
+		return nil, err
+	}
+
+	roles := []rbacv1.Role{}
+	for i := range roleList.Items {
+		if isControlledBy(&roleList.Items[i], accessRequest) {
+			roles = append(roles, roleList.Items[i])
+		}
+	}
+	return roles, nil
+}
+
+// deleteControlledRoles deletes the roles created for the rules of the accessrequest
+func (r *AccessRequestReconciler) deleteControlledRoles(ctx context.Context, log logr.Logger, accessRequest *iamv1alpha1.AccessRequest) error {
+	roles, err := r.getControlledRoles(ctx, accessRequest)
+	if err != nil {
+		return err
+	}
+	return r.deleteRoles(ctx, log, accessRequest, roles)
+}
+
+// deleteRoles deletes the given roles controlled by the accessrequest
+func (r *AccessRequestReconciler) deleteRoles(ctx context.Context, log logr.Logger, accessRequest *iamv1alpha1.AccessRequest, roles []rbacv1.Role) error {
+	for i := range roles {
+		if err := r.Delete(ctx, &roles[i]); err != nil && !k8serrors.IsNotFound(err) {
+			return err
+		}
+		message := fmt.Sprintf("Role %s/%s deleted", roles[i].Namespace, roles[i].Name)
+		r.Recorder.Event(accessRequest, v1.EventTypeNormal, "RoleDeleted", message)
+		log.Info(message)
+	}
+	return nil
+}
+
+// archive writes a record of the accessrequest and the rolebindings it created to the archive and
+// sets the archive time of the accessrequest
+func (r *AccessRequestReconciler) archive(ctx context.Context, reason string, accessRequest *iamv1alpha1.AccessRequest, roleBindings []rbacv1.RoleBinding) error {
+	archiveTime := metav1.Now()
+	accessRequest.Status.ArchiveTime = &archiveTime
+
+	if err := r.Archiver.Write(ctx, archive.NewRecord(reason, accessRequest, roleBindings)); err != nil {
+		accessRequest.Status.ArchiveTime = nil
+		return fmt.Errorf("failed to archive accessrequest: %v", err)
+	}
+	r.Recorder.Event(accessRequest, v1.EventTypeNormal, "AccessRequestArchived", "AccessRequest archived")
+
+	return nil
+}
+
+// untilDeletion returns the duration until a finished accessrequest should be deleted and whether
+// it should be deleted at all
+func (r *AccessRequestReconciler) untilDeletion(accessRequest *iamv1alpha1.AccessRequest) (time.Duration, bool) {
+	finishedTime := finishedTime(accessRequest)
+	if finishedTime == nil {
+		return 0, false
+	}
+
+	// Finished accessrequests must be archived before they are deleted
+	if r.Archiver != nil && accessRequest.Status.ArchiveTime.IsZero() {
+		return 0, false
+	}
+
+	ttlSecondsAfterFinished := r.TTLSecondsAfterFinished
+	if accessRequest.Spec.TTLSecondsAfterFinished != nil {
+		ttlSecondsAfterFinished = accessRequest.Spec.TTLSecondsAfterFinished
+	}
+	if ttlSecondsAfterFinished == nil {
+		return 0, false
+	}
+
+	return time.Until(finishedTime.Add(time.Duration(*ttlSecondsAfterFinished) * time.Second)), true
+}
+
+// grantDuration returns how long the accessrequest grants access for or zero if access is not
+// time-bound. Break-glass accessrequests are always time-bound
+func (r *AccessRequestReconciler) grantDuration(accessRequest *iamv1alpha1.AccessRequest) time.Duration {
+	var duration time.Duration
+	if accessRequest.Spec.Duration != nil {
+		duration = accessRequest.Spec.Duration.Duration
+	}
+	if accessRequest.Spec.BreakGlass != nil && (duration == 0 || duration > r.BreakGlassMaxDuration) {
+		duration = r.BreakGlassMaxDuration
+	}
+	return duration
+}
+
+// SetupWithManager registers the controller with the manager. The bindings granting approvers the
+// approve verb are not watched; approvers are checked again whenever the accessrequest is reconciled
 func (r *AccessRequestReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&iamv1alpha1.AccessRequest{}).
 		Owns(&rbacv1.RoleBinding{}).
+		Owns(&rbacv1.Role{}).
+		// Objects in other namespaces than their accessrequest have no owner reference
+		Watches(&source.Kind{Type: &rbacv1.RoleBinding{}}, handler.EnqueueRequestsFromMapFunc(mapObjectToAccessRequest)).
+		Watches(&source.Kind{Type: &rbacv1.Role{}}, handler.EnqueueRequestsFromMapFunc(mapObjectToAccessRequest)).
+		// Namespaces created or relabelled while an accessrequest is active may need to be granted
+		// access in or have access revoked
+		Watches(&source.Kind{Type: &v1.Namespace{}}, handler.EnqueueRequestsFromMapFunc(r.mapNamespaceToAccessRequests)).
+		// Roles created or changed after an accessrequest is approved may need access to be suspended
+		Watches(&source.Kind{Type: &rbacv1.Role{}}, handler.EnqueueRequestsFromMapFunc(r.mapRoleToAccessRequests)).
+		Watches(&source.Kind{Type: &rbacv1.ClusterRole{}}, handler.EnqueueRequestsFromMapFunc(r.mapRoleToAccessRequests)).
+		// Approvals made through a delegation are no longer allowed once it is deleted, which rejects
+		// pending accessrequests and suspends access granted by activated ones
+		Watches(&source.Kind{Type: &iamv1alpha1.ApproverDelegation{}}, handler.EnqueueRequestsFromMapFunc(r.mapDelegationToAccessRequests)).
 		Complete(r)
-	// TODO: watch for roles and rolebindings in case approver becomes able to approve
+}
+
+// mapObjectToAccessRequest returns a request for the accessrequest recorded on an object created
+// for it in another namespace
+func mapObjectToAccessRequest(object client.Object) []reconcile.Request {
+	if object.GetLabels()[iamv1alpha1.AccessRequestUIDLabel] == "" {
+		return nil
+	}
+	parts := strings.SplitN(object.GetAnnotations()[iamv1alpha1.AccessRequestAnnotation], "/", 2)
+	if len(parts) != 2 || object.GetNamespace() == parts[0] {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: parts[0], Name: parts[1]}}}
+}
+
+// mapNamespaceToAccessRequests returns requests for every accessrequest that grants access in
+// namespaces other than its own
+func (r *AccessRequestReconciler) mapNamespaceToAccessRequests(object client.Object) []reconcile.Request {
+	accessRequestList := &iamv1alpha1.AccessRequestList{}
+	if err := r.List(context.Background(), accessRequestList); err != nil {
+		r.Log.Error(err, "failed to list AccessRequests", "namespace", object.GetName())
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+	for _, accessRequest := range accessRequestList.Items {
+		if len(accessRequest.Spec.Namespaces) == 0 && accessRequest.Spec.NamespaceSelector == nil {
+			continue
+		}
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+			Namespace: accessRequest.Namespace,
+			Name:      accessRequest.Name,
+		}})
+	}
+	return requests
+}
+
+// mapRoleToAccessRequests returns requests for every accessrequest that references a role or
+// clusterrole, so that roles changed or created after approval suspend access
+func (r *AccessRequestReconciler) mapRoleToAccessRequests(object client.Object) []reconcile.Request {
+	kind := "ClusterRole"
+	if object.GetNamespace() != "" {
+		kind = "Role"
+	}
+
+	accessRequestList := &iamv1alpha1.AccessRequestList{}
+	if err := r.List(context.Background(), accessRequestList); err != nil {
+		r.Log.Error(err, "failed to list AccessRequests", strings.ToLower(kind), object.GetName())
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+	for _, accessRequest := range accessRequestList.Items {
+		for _, roleRef := range iamv1alpha1.RoleRefs(&accessRequest) {
+			if roleRef.Kind == kind && roleRef.Name == object.GetName() {
+				requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+					Namespace: accessRequest.Namespace,
+					Name:      accessRequest.Name,
+				}})
+				break
+			}
+		}
+	}
+	return requests
+}
+
+// mapDelegationToAccessRequests returns requests for every accessrequest approved through an
+// approverdelegation
+func (r *AccessRequestReconciler) mapDelegationToAccessRequests(object client.Object) []reconcile.Request {
+	approverDelegation, ok := object.(*iamv1alpha1.ApproverDelegation)
+	if !ok {
+		return nil
+	}
+
+	accessRequestList := &iamv1alpha1.AccessRequestList{}
+	if err := r.List(context.Background(), accessRequestList); err != nil {
+		r.Log.Error(err, "failed to list AccessRequests", "approverdelegation", object.GetName())
+		return nil
+	}
+
+	requests := []reconcile.Request{}
+	for i := range accessRequestList.Items {
+		accessRequest := &accessRequestList.Items[i]
+		approvals := iamv1alpha1.Approvals(accessRequest)
+		for j := range accessRequest.Spec.Extensions {
+			approvals = append(approvals, accessRequest.Spec.Extensions[j].Approvals...)
+		}
+		for _, approval := range approvals {
+			if approval.Delegator == approverDelegation.Spec.Delegator && approval.User == approverDelegation.Spec.Delegate {
+				requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+					Namespace: accessRequest.Namespace,
+					Name:      accessRequest.Name,
+				}})
+				break
+			}
+		}
+	}
+	return requests
 }
@@ -0,0 +1,382 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	iamv1alpha1 "github.com/dippynark/access-request-controller/api/v1alpha1"
+	"github.com/dippynark/access-request-controller/pkg/archive"
+	"github.com/go-logr/logr"
+	authv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// binding grants, or if deny is set denies, a verb on accessrequests in a namespace to a user or
+// group
+type binding struct {
+	user      string
+	group     string
+	verb      string
+	namespace string
+	deny      bool
+}
+
+// sarClient answers subjectaccessreviews from the given bindings in place of the API server
+type sarClient struct {
+	client.Client
+	bindings []binding
+}
+
+func (c *sarClient) Create(_ context.Context, obj client.Object, _ ...client.CreateOption) error {
+	sar := obj.(*authv1.SubjectAccessReview)
+	attributes := sar.Spec.ResourceAttributes
+	for _, b := range c.bindings {
+		if b.verb != attributes.Verb || b.namespace != attributes.Namespace {
+			continue
+		}
+		matched := b.user != "" && b.user == sar.Spec.User
+		for _, group := range sar.Spec.Groups {
+			matched = matched || (b.group != "" && b.group == group)
+		}
+		if matched && b.deny {
+			sar.Status.Allowed = false
+			sar.Status.Denied = true
+			return nil
+		}
+		sar.Status.Allowed = sar.Status.Allowed || matched
+	}
+	return nil
+}
+
+func TestNamespaceAllowedBreakGlass(t *testing.T) {
+	tests := []struct {
+		name      string
+		userInfo  *iamv1alpha1.UserInfo
+		bindings  []binding
+		namespace string
+		want      bool
+	}{
+		{
+			name:      "allowed through user binding",
+			bindings:  []binding{{user: "developer", verb: breakGlassVerb, namespace: "default"}},
+			namespace: "default",
+			want:      true,
+		},
+		{
+			name:      "allowed through group binding",
+			userInfo:  &iamv1alpha1.UserInfo{Groups: []string{"developers", "on-call"}},
+			bindings:  []binding{{group: "on-call", verb: breakGlassVerb, namespace: "default"}},
+			namespace: "default",
+			want:      true,
+		},
+		{
+			name:      "group binding in another namespace",
+			userInfo:  &iamv1alpha1.UserInfo{Groups: []string{"on-call"}},
+			bindings:  []binding{{group: "on-call", verb: breakGlassVerb, namespace: "default"}},
+			namespace: "production",
+			want:      false,
+		},
+		{
+			name:      "group binding without recorded groups",
+			bindings:  []binding{{group: "on-call", verb: breakGlassVerb, namespace: "default"}},
+			namespace: "default",
+			want:      false,
+		},
+		{
+			name:      "approve is not enough to break glass",
+			userInfo:  &iamv1alpha1.UserInfo{Groups: []string{"on-call"}},
+			bindings:  []binding{{group: "on-call", verb: approveVerb, namespace: "default"}},
+			namespace: "default",
+			want:      false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &AccessRequestReconciler{Client: &sarClient{bindings: tt.bindings}}
+			accessRequest := &iamv1alpha1.AccessRequest{
+				ObjectMeta: metav1.ObjectMeta{Name: "incident", Namespace: "default"},
+				Spec: iamv1alpha1.AccessRequestSpec{
+					BreakGlass: &iamv1alpha1.BreakGlass{Justification: "Investigating checkout outage"},
+					Attributes: &iamv1alpha1.Attributes{
+						CreatedBy:         "developer",
+						CreatedByUserInfo: tt.userInfo,
+					},
+				},
+			}
+			allowed, message, err := r.namespaceAllowed(context.Background(), accessRequest, tt.namespace)
+			if err != nil {
+				t.Fatalf("namespaceAllowed() error = %v", err)
+			}
+			if allowed != tt.want {
+				t.Errorf("namespaceAllowed() = %v (%s), want %v", allowed, message, tt.want)
+			}
+		})
+	}
+}
+
+func TestApproverAllowed(t *testing.T) {
+	tests := []struct {
+		name     string
+		approval iamv1alpha1.Approval
+		bindings []binding
+		want     bool
+	}{
+		{
+			name:     "allowed through user binding",
+			approval: iamv1alpha1.Approval{User: "alice"},
+			bindings: []binding{{user: "alice", verb: approveVerb, namespace: "default"}},
+			want:     true,
+		},
+		{
+			name:     "allowed through escalated group binding",
+			approval: iamv1alpha1.Approval{User: "alice", UserInfo: &iamv1alpha1.UserInfo{Groups: []string{"team-leads"}}},
+			bindings: []binding{{group: "team-leads", verb: approveVerb, namespace: "default"}},
+			want:     true,
+		},
+		{
+			name:     "group binding without recorded groups",
+			approval: iamv1alpha1.Approval{User: "alice"},
+			bindings: []binding{{group: "team-leads", verb: approveVerb, namespace: "default"}},
+			want:     false,
+		},
+		{
+			name:     "denied despite group binding",
+			approval: iamv1alpha1.Approval{User: "alice", UserInfo: &iamv1alpha1.UserInfo{Groups: []string{"team-leads"}}},
+			bindings: []binding{
+				{group: "team-leads", verb: approveVerb, namespace: "default"},
+				{user: "alice", verb: approveVerb, namespace: "default", deny: true},
+			},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &AccessRequestReconciler{Client: &sarClient{bindings: tt.bindings}}
+			accessRequest := &iamv1alpha1.AccessRequest{
+				ObjectMeta: metav1.ObjectMeta{Name: "debug", Namespace: "default"},
+			}
+			allowed, err := r.approverAllowed(context.Background(), accessRequest, tt.approval, "default")
+			if err != nil {
+				t.Fatalf("approverAllowed() error = %v", err)
+			}
+			if allowed != tt.want {
+				t.Errorf("approverAllowed() = %v, want %v", allowed, tt.want)
+			}
+		})
+	}
+}
+
+func TestReconcileApprovedRoles(t *testing.T) {
+	reader := rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}}
+	writer := rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "delete"}}
+	newRole := func(rules ...rbacv1.PolicyRule) *rbacv1.Role {
+		return &rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Name: "pod-reader", Namespace: "default"}, Rules: rules}
+	}
+
+	tests := []struct {
+		name         string
+		approvedRole *rbacv1.Role
+		role         *rbacv1.Role
+		wantReason   string
+	}{
+		{
+			name:         "role unchanged",
+			approvedRole: newRole(reader),
+			role:         newRole(reader),
+		},
+		{
+			name:         "role narrowed",
+			approvedRole: newRole(writer),
+			role:         newRole(reader),
+		},
+		{
+			name:         "role broadened",
+			approvedRole: newRole(reader),
+			role:         newRole(writer),
+			wantReason:   "RoleBroadened",
+		},
+		{
+			name:       "role created after approval",
+			role:       newRole(reader),
+			wantReason: "RoleNotApproved",
+		},
+		{
+			name: "role never created",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			accessRequest := &iamv1alpha1.AccessRequest{
+				ObjectMeta: metav1.ObjectMeta{Name: "debug", Namespace: "default"},
+				Spec: iamv1alpha1.AccessRequestSpec{
+					RoleRef: rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: "pod-reader"},
+				},
+			}
+			namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}}
+
+			// Record the roles as they were when the accessrequest was approved
+			builder := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(namespace)
+			if tt.approvedRole != nil {
+				builder = builder.WithObjects(tt.approvedRole)
+			}
+			r := &AccessRequestReconciler{Client: builder.Build()}
+			if unapproved, err := r.reconcileApprovedRoles(context.Background(), accessRequest); err != nil || unapproved != "" {
+				t.Fatalf("recording approved roles returned %q, %v", unapproved, err)
+			}
+			if accessRequest.Status.ApprovedRolesTime == nil {
+				t.Fatal("expected approved roles to have been recorded")
+			}
+
+			builder = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(namespace)
+			if tt.role != nil {
+				builder = builder.WithObjects(tt.role)
+			}
+			r.Client = builder.Build()
+			unapproved, err := r.reconcileApprovedRoles(context.Background(), accessRequest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if suspended := tt.wantReason != ""; suspended != (unapproved != "") {
+				t.Fatalf("got %q, want suspended %t", unapproved, suspended)
+			}
+			// The role changed condition is only added once a role grants more than was approved
+			condition := getCondition(accessRequest.Status.Conditions, iamv1alpha1.AccessRequestRoleChanged)
+			if tt.wantReason != "" && (condition == nil || condition.Reason != tt.wantReason) {
+				t.Errorf("got condition %+v, want reason %s", condition, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestReconcileApprovalDelegationDeleted(t *testing.T) {
+	testScheme := runtime.NewScheme()
+	if err := scheme.AddToScheme(testScheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := iamv1alpha1.AddToScheme(testScheme); err != nil {
+		t.Fatal(err)
+	}
+
+	now := metav1.Now()
+	accessRequest := &iamv1alpha1.AccessRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: "debug", Namespace: "default", UID: "1234"},
+		Spec: iamv1alpha1.AccessRequestSpec{
+			Approved: true,
+			Attributes: &iamv1alpha1.Attributes{
+				CreatedBy:  "developer",
+				ApprovedBy: "bob",
+				Approvals:  []iamv1alpha1.Approval{{User: "bob", Delegator: "alice", Time: now}},
+			},
+		},
+		Status: iamv1alpha1.AccessRequestStatus{
+			CompletionTime: &now,
+			Conditions:     []iamv1alpha1.AccessRequestCondition{{Type: iamv1alpha1.AccessRequestComplete, Status: corev1.ConditionTrue}},
+		},
+	}
+	controller := true
+	roleBinding := &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "debug",
+			Namespace:       "default",
+			Labels:          map[string]string{iamv1alpha1.AccessRequestUIDLabel: "1234"},
+			OwnerReferences: []metav1.OwnerReference{{Kind: "AccessRequest", Name: "debug", UID: "1234", Controller: &controller}},
+		},
+	}
+
+	// The approverdelegation that bob approved through has been deleted
+	c := fake.NewClientBuilder().WithScheme(testScheme).WithObjects(roleBinding).Build()
+	r := &AccessRequestReconciler{Client: c, Log: logr.Discard(), Recorder: record.NewFakeRecorder(10)}
+	approved, err := r.reconcileApproval(context.Background(), accessRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if approved {
+		t.Fatal("expected approval through a deleted delegation not to be allowed")
+	}
+	if condition := getCondition(accessRequest.Status.Conditions, iamv1alpha1.AccessRequestComplete); condition == nil || condition.Reason != "ApproverDenied" {
+		t.Errorf("got complete condition %+v, want reason ApproverDenied", condition)
+	}
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(roleBinding), &rbacv1.RoleBinding{}); !k8serrors.IsNotFound(err) {
+		t.Errorf("expected rolebinding to be deleted, got %v", err)
+	}
+}
+
+// recordingSink records the reasons of archived records
+type recordingSink struct {
+	reasons []string
+}
+
+func (s *recordingSink) Write(_ context.Context, record *archive.Record) error {
+	s.reasons = append(s.reasons, record.Reason)
+	return nil
+}
+
+func TestReconcileDeleteArchivesOnce(t *testing.T) {
+	now := metav1.Now()
+	tests := []struct {
+		name        string
+		archiveTime *metav1.Time
+		want        []string
+	}{
+		{
+			name: "not archived",
+			want: []string{"Deleted"},
+		},
+		{
+			name:        "archived when finished",
+			archiveTime: &now,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			accessRequest := &iamv1alpha1.AccessRequest{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "debug",
+					Namespace:         "default",
+					UID:               "1234",
+					DeletionTimestamp: &now,
+					Finalizers:        []string{accessRequestFinalizer},
+				},
+				Status: iamv1alpha1.AccessRequestStatus{ArchiveTime: tt.archiveTime},
+			}
+			sink := &recordingSink{}
+			r := &AccessRequestReconciler{
+				Client:   fake.NewClientBuilder().WithScheme(scheme.Scheme).Build(),
+				Log:      logr.Discard(),
+				Recorder: record.NewFakeRecorder(10),
+				Archiver: sink,
+			}
+			if _, err := r.reconcileDelete(context.Background(), accessRequest); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(sink.reasons, tt.want) {
+				t.Errorf("got archived records %v, want %v", sink.reasons, tt.want)
+			}
+		})
+	}
+}
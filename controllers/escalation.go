@@ -0,0 +1,125 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	iamv1alpha1 "github.com/dippynark/access-request-controller/api/v1alpha1"
+	authv1 "k8s.io/api/authorization/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// EscalationTier escalates accessrequests that have not been approved within a period of their
+// creation to a group of approvers. Escalation only notifies the group; it does not grant any
+// permissions, so the group must already be allowed to approve accessrequests
+type EscalationTier struct {
+	// After is the period after creation at which pending accessrequests are escalated
+	After time.Duration
+	// Group is the group of approvers that accessrequests are escalated to
+	Group string
+}
+
+// ParseEscalationTiers parses escalation tiers of the form 30m=team-leads,2h=platform-admins,
+// ordered by when they apply
+func ParseEscalationTiers(value string) ([]EscalationTier, error) {
+	tiers := []EscalationTier{}
+	if value == "" {
+		return tiers, nil
+	}
+	for _, tier := range strings.Split(value, ",") {
+		parts := strings.SplitN(tier, "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, fmt.Errorf("escalation tier %q must be of the form <duration>=<group>", tier)
+		}
+		after, err := time.ParseDuration(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("escalation tier %q has an invalid duration: %v", tier, err)
+		}
+		if after <= 0 {
+			return nil, fmt.Errorf("escalation tier %q must have a positive duration", tier)
+		}
+		tiers = append(tiers, EscalationTier{After: after, Group: parts[1]})
+	}
+	sort.SliceStable(tiers, func(i, j int) bool {
+		return tiers[i].After < tiers[j].After
+	})
+	return tiers, nil
+}
+
+// reconcileEscalation escalates the pending accessrequest to each approver group whose tier applies
+// and has not already been escalated to, and returns the duration until the next tier applies
+func (r *AccessRequestReconciler) reconcileEscalation(ctx context.Context, accessRequest *iamv1alpha1.AccessRequest) (time.Duration, error) {
+	log := r.Log.WithValues("accessrequest", fmt.Sprintf("%s/%s", accessRequest.Namespace, accessRequest.Name))
+
+	// Escalations are recorded in tier order so the number recorded is the next tier
+	for i := len(accessRequest.Status.Escalations); i < len(r.EscalationTiers); i++ {
+		tier := r.EscalationTiers[i]
+		untilEscalation := time.Until(accessRequest.CreationTimestamp.Add(tier.After))
+		if untilEscalation > 0 {
+			return untilEscalation, nil
+		}
+
+		accessRequest.Status.Escalations = append(accessRequest.Status.Escalations, iamv1alpha1.Escalation{
+			Group: tier.Group,
+			Time:  metav1.Now(),
+		})
+		message := fmt.Sprintf("AccessRequest has not been approved within %s; escalated to group %s", tier.After, tier.Group)
+		// The group is recorded on the event so that notifications can be routed to it
+		r.Recorder.AnnotatedEventf(accessRequest, map[string]string{iamv1alpha1.ApproverGroupAnnotation: tier.Group}, v1.EventTypeWarning, "Escalated", message)
+		log.Info(message)
+
+		// Escalating to a group that cannot approve the accessrequest will not get it approved
+		allowed, err := r.groupAllowed(ctx, accessRequest, tier.Group, approveVerb)
+		if err != nil {
+			return 0, err
+		}
+		if !allowed {
+			message := fmt.Sprintf("Group %s is not allowed to approve AccessRequests in namespace %s", tier.Group, accessRequest.Namespace)
+			r.Recorder.AnnotatedEventf(accessRequest, map[string]string{iamv1alpha1.ApproverGroupAnnotation: tier.Group}, v1.EventTypeWarning, "EscalationGroupNotAllowed", message)
+			log.Info(message)
+		}
+	}
+	return 0, nil
+}
+
+// groupAllowed returns whether members of the given group may perform the given verb on the
+// accessrequest in its namespace through the permissions bound to the group
+func (r *AccessRequestReconciler) groupAllowed(ctx context.Context, accessRequest *iamv1alpha1.AccessRequest, group, verb string) (bool, error) {
+	sar := &authv1.SubjectAccessReview{
+		Spec: authv1.SubjectAccessReviewSpec{
+			Groups: []string{group},
+			ResourceAttributes: &authv1.ResourceAttributes{
+				Namespace: accessRequest.Namespace,
+				Name:      accessRequest.Name,
+				Verb:      verb,
+				Group:     iamv1alpha1.GroupVersion.Group,
+				Version:   iamv1alpha1.GroupVersion.Version,
+				Resource:  accessRequestResourcePlural,
+			},
+		},
+	}
+	if err := r.Create(ctx, sar); err != nil {
+		return false, err
+	}
+	return sar.Status.Allowed && !sar.Status.Denied, nil
+}
@@ -0,0 +1,151 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	iamv1alpha1 "github.com/dippynark/access-request-controller/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseEscalationTiers(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    []EscalationTier
+		wantErr bool
+	}{
+		{
+			name:  "empty",
+			value: "",
+			want:  []EscalationTier{},
+		},
+		{
+			name:  "single tier",
+			value: "30m=team-leads",
+			want:  []EscalationTier{{After: 30 * time.Minute, Group: "team-leads"}},
+		},
+		{
+			name:  "multiple tiers",
+			value: "30m=team-leads,2h=platform-admins",
+			want: []EscalationTier{
+				{After: 30 * time.Minute, Group: "team-leads"},
+				{After: 2 * time.Hour, Group: "platform-admins"},
+			},
+		},
+		{
+			name:  "tiers are ordered by duration",
+			value: "2h=platform-admins,30m=team-leads",
+			want: []EscalationTier{
+				{After: 30 * time.Minute, Group: "team-leads"},
+				{After: 2 * time.Hour, Group: "platform-admins"},
+			},
+		},
+		{
+			name:  "group containing equals sign",
+			value: "1h=team=leads",
+			want:  []EscalationTier{{After: time.Hour, Group: "team=leads"}},
+		},
+		{
+			name:    "missing group",
+			value:   "30m=",
+			wantErr: true,
+		},
+		{
+			name:    "missing separator",
+			value:   "30m",
+			wantErr: true,
+		},
+		{
+			name:    "invalid duration",
+			value:   "soon=team-leads",
+			wantErr: true,
+		},
+		{
+			name:    "zero duration",
+			value:   "0s=team-leads",
+			wantErr: true,
+		},
+		{
+			name:    "negative duration",
+			value:   "-30m=team-leads",
+			wantErr: true,
+		},
+		{
+			name:    "trailing comma",
+			value:   "30m=team-leads,",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseEscalationTiers(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseEscalationTiers(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseEscalationTiers(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGroupAllowed(t *testing.T) {
+	tests := []struct {
+		name     string
+		bindings []binding
+		want     bool
+	}{
+		{
+			name:     "allowed",
+			bindings: []binding{{group: "team-leads", verb: approveVerb, namespace: "default"}},
+			want:     true,
+		},
+		{
+			name:     "not bound",
+			bindings: []binding{{group: "platform-admins", verb: approveVerb, namespace: "default"}},
+			want:     false,
+		},
+		{
+			name: "denied",
+			bindings: []binding{
+				{group: "team-leads", verb: approveVerb, namespace: "default"},
+				{group: "team-leads", verb: approveVerb, namespace: "default", deny: true},
+			},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &AccessRequestReconciler{Client: &sarClient{bindings: tt.bindings}}
+			accessRequest := &iamv1alpha1.AccessRequest{
+				ObjectMeta: metav1.ObjectMeta{Name: "debug", Namespace: "default"},
+			}
+			allowed, err := r.groupAllowed(context.Background(), accessRequest, "team-leads", approveVerb)
+			if err != nil {
+				t.Fatalf("groupAllowed() error = %v", err)
+			}
+			if allowed != tt.want {
+				t.Errorf("groupAllowed() = %v, want %v", allowed, tt.want)
+			}
+		})
+	}
+}
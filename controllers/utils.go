@@ -2,17 +2,25 @@ package controllers
 
 import (
 	"context"
-	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	iamv1alpha1 "github.com/dippynark/access-request-controller/api/v1alpha1"
 	authv1 "k8s.io/api/authorization/v1"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
 )
 
 const (
 	approveVerb                 = "approve"
+	breakGlassVerb              = "breakglass"
 	accessRequestResourcePlural = "accessrequests"
+
+	// accessRequestFinalizer allows the reconciler to revoke access and record the deletion before
+	// an accessrequest is removed
+	accessRequestFinalizer = "accessrequest.iam.dippynark.co.uk"
 )
 
 // ensureAccessRequestConditionStatus appends or updates an existing accessrequest condition of the
@@ -39,6 +47,16 @@ func setConditionStatus(list []iamv1alpha1.AccessRequestCondition, cType iamv1al
 	return list
 }
 
+// getCondition returns the accessrequest condition of the given type or nil if it does not exist
+func getCondition(list []iamv1alpha1.AccessRequestCondition, cType iamv1alpha1.AccessRequestConditionType) *iamv1alpha1.AccessRequestCondition {
+	for i := range list {
+		if list[i].Type == cType {
+			return &list[i]
+		}
+	}
+	return nil
+}
+
 func newCondition(conditionType iamv1alpha1.AccessRequestConditionType, status v1.ConditionStatus, reason, message string) iamv1alpha1.AccessRequestCondition {
 	return iamv1alpha1.AccessRequestCondition{
 		Type:               conditionType,
@@ -50,22 +68,150 @@ func newCondition(conditionType iamv1alpha1.AccessRequestConditionType, status v
 	}
 }
 
-func (r *AccessRequestReconciler) checkAccess(ctx context.Context, accessRequest *iamv1alpha1.AccessRequest) (*authv1.SubjectAccessReview, error) {
+// roleBindingAnnotations returns the annotations recording why the accessrequest was made, so that
+// they can be found on the bindings it creates
+func roleBindingAnnotations(accessRequest *iamv1alpha1.AccessRequest) map[string]string {
+	annotations := map[string]string{}
+	if accessRequest.Spec.Reason != "" {
+		annotations[iamv1alpha1.ReasonAnnotation] = accessRequest.Spec.Reason
+	}
+	if accessRequest.Spec.Ticket != "" {
+		annotations[iamv1alpha1.TicketAnnotation] = accessRequest.Spec.Ticket
+	}
+	for key, value := range accessRequest.Spec.Context {
+		annotations[iamv1alpha1.ContextAnnotationPrefix+key] = value
+	}
+	return annotations
+}
+
+// isExpired returns whether access granted by the accessrequest has expired
+func isExpired(accessRequest *iamv1alpha1.AccessRequest) bool {
+	return !accessRequest.Status.ExpirationTime.IsZero() && !time.Now().Before(accessRequest.Status.ExpirationTime.Time)
+}
+
+// finishedTime returns the time at which the accessrequest finished, meaning that access granted by
+// it was revoked or it was rejected, or nil if it has not finished
+func finishedTime(accessRequest *iamv1alpha1.AccessRequest) *metav1.Time {
+	for _, conditionType := range []iamv1alpha1.AccessRequestConditionType{iamv1alpha1.AccessRequestExpired, iamv1alpha1.AccessRequestRejected} {
+		condition := getCondition(accessRequest.Status.Conditions, conditionType)
+		if condition != nil && condition.Status == v1.ConditionTrue {
+			return &condition.LastTransitionTime
+		}
+	}
+	return nil
+}
+
+// closedReason returns the reason the accessrequest was closed without granting access, because it
+// timed out or was rejected, or an empty string if it has not been closed
+func closedReason(accessRequest *iamv1alpha1.AccessRequest) string {
+	if condition := getCondition(accessRequest.Status.Conditions, iamv1alpha1.AccessRequestExpired); condition != nil && condition.Status == v1.ConditionTrue && condition.Reason == "TimedOut" {
+		return condition.Reason
+	}
+	if condition := getCondition(accessRequest.Status.Conditions, iamv1alpha1.AccessRequestRejected); condition != nil && condition.Status == v1.ConditionTrue {
+		return "Rejected"
+	}
+	return ""
+}
+
+// roleBindingsCreatedMessage returns the message recorded once all rolebindings for the
+// accessrequest have been created. Rolebindings in other namespaces than the accessrequest are
+// qualified with their namespace
+func roleBindingsCreatedMessage(accessRequest *iamv1alpha1.AccessRequest) string {
+	names := []string{}
+	for _, status := range accessRequest.Status.RoleBindings {
+		if !status.Bound {
+			continue
+		}
+		if status.Namespace != "" && status.Namespace != accessRequest.Namespace {
+			names = append(names, fmt.Sprintf("%s/%s", status.Namespace, status.Name))
+			continue
+		}
+		names = append(names, status.Name)
+	}
+	if len(names) == 1 {
+		return fmt.Sprintf("RoleBinding %s created", names[0])
+	}
+	return fmt.Sprintf("RoleBindings %s created", strings.Join(names, ", "))
+}
+
+// anyBound returns whether any of the given rolebindings are bound
+func anyBound(statuses []iamv1alpha1.RoleBindingStatus) bool {
+	for _, status := range statuses {
+		if status.Bound {
+			return true
+		}
+	}
+	return false
+}
+
+// accessRequestObjectMeta returns the metadata of an object with the given name and namespace
+// created for the accessrequest
+func accessRequestObjectMeta(accessRequest *iamv1alpha1.AccessRequest, namespace, name string) metav1.ObjectMeta {
+	annotations := roleBindingAnnotations(accessRequest)
+	annotations[iamv1alpha1.AccessRequestAnnotation] = fmt.Sprintf("%s/%s", accessRequest.Namespace, accessRequest.Name)
+	return metav1.ObjectMeta{
+		Name:      name,
+		Namespace: namespace,
+		Labels: map[string]string{
+			iamv1alpha1.AccessRequestUIDLabel: string(accessRequest.UID),
+		},
+		Annotations: annotations,
+	}
+}
+
+// isControlledBy returns whether the object was created for the accessrequest. Objects in the
+// namespace of the accessrequest are controlled through their owner reference while those in other
+// namespaces are identified by their label and annotation
+func isControlledBy(object metav1.Object, accessRequest *iamv1alpha1.AccessRequest) bool {
+	if object.GetNamespace() == accessRequest.Namespace {
+		ref := metav1.GetControllerOf(object)
+		return ref != nil && ref.UID == accessRequest.UID
+	}
+	return object.GetLabels()[iamv1alpha1.AccessRequestUIDLabel] == string(accessRequest.UID) &&
+		object.GetAnnotations()[iamv1alpha1.AccessRequestAnnotation] == fmt.Sprintf("%s/%s", accessRequest.Namespace, accessRequest.Name)
+}
+
+// approvalTime returns the time of the latest approval of the accessrequest or nil if approvals
+// were not recorded
+func approvalTime(accessRequest *iamv1alpha1.AccessRequest) *metav1.Time {
 	if accessRequest.Spec.Attributes == nil {
-		return nil, errors.New("spec.attributes.approvedBy is nil")
+		return nil
+	}
+	var latest *metav1.Time
+	for i := range accessRequest.Spec.Attributes.Approvals {
+		approval := &accessRequest.Spec.Attributes.Approvals[i]
+		if latest == nil || latest.Before(&approval.Time) {
+			latest = &approval.Time
+		}
+	}
+	return latest
+}
+
+// requeueAfter returns the given result updated to requeue no later than the given duration. A
+// duration of zero is ignored
+func requeueAfter(result ctrl.Result, duration time.Duration) ctrl.Result {
+	if duration > 0 && (result.RequeueAfter == 0 || duration < result.RequeueAfter) {
+		result.RequeueAfter = duration
+	}
+	return result
+}
+
+// checkAccess returns whether the given user, including the groups recorded for them if any, may
+// perform the given verb on the accessrequest in the given namespace
+func (r *AccessRequestReconciler) checkAccess(ctx context.Context, accessRequest *iamv1alpha1.AccessRequest, user string, userInfo *iamv1alpha1.UserInfo, verb, namespace string) (*authv1.SubjectAccessReview, error) {
+	if user == "" {
+		return nil, fmt.Errorf("user to check %s access for is not set", verb)
 	}
 	sar := &authv1.SubjectAccessReview{
-		Spec: authv1.SubjectAccessReviewSpec{
-			User: accessRequest.Spec.Attributes.ApprovedBy,
-			ResourceAttributes: &authv1.ResourceAttributes{
-				Namespace: accessRequest.Namespace,
-				Name:      accessRequest.Name,
-				Verb:      approveVerb,
-				Group:     iamv1alpha1.GroupVersion.Group,
-				Version:   iamv1alpha1.GroupVersion.Version,
-				Resource:  accessRequestResourcePlural,
-			},
-		},
+		Spec: iamv1alpha1.SubjectAccessReviewSpec(user, userInfo),
+	}
+	sar.Spec.ResourceAttributes = &authv1.ResourceAttributes{
+		Namespace: namespace,
+		Name:      accessRequest.Name,
+		Verb:      verb,
+		Group:     iamv1alpha1.GroupVersion.Group,
+		Version:   iamv1alpha1.GroupVersion.Version,
+		Resource:  accessRequestResourcePlural,
 	}
 	err := r.Create(ctx, sar)
 	if err != nil {
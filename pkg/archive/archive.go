@@ -0,0 +1,97 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package archive writes records of finished accessrequests to durable storage so that evidence of
+// access outlives the accessrequests themselves
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	iamv1alpha1 "github.com/dippynark/access-request-controller/api/v1alpha1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Record is the archived record of an accessrequest
+type Record struct {
+	// Time when the record was written
+	ArchiveTime metav1.Time `json:"archiveTime"`
+
+	// Reason the record was written, for example because the accessrequest expired
+	Reason string `json:"reason"`
+
+	// The accessrequest including its spec, attributes and status
+	AccessRequest *iamv1alpha1.AccessRequest `json:"accessRequest"`
+
+	// Snapshot of the rolebindings created for the accessrequest, if any
+	// +optional
+	RoleBindings []rbacv1.RoleBinding `json:"roleBindings,omitempty"`
+}
+
+// Sink stores archived records
+type Sink interface {
+	// Write durably stores the given record
+	Write(ctx context.Context, record *Record) error
+}
+
+// NewRecord returns a record of the given accessrequest and rolebindings
+func NewRecord(reason string, accessRequest *iamv1alpha1.AccessRequest, roleBindings []rbacv1.RoleBinding) *Record {
+	record := &Record{
+		ArchiveTime:   metav1.Now(),
+		Reason:        reason,
+		AccessRequest: accessRequest.DeepCopy(),
+	}
+	for i := range roleBindings {
+		record.RoleBindings = append(record.RoleBindings, *roleBindings[i].DeepCopy())
+	}
+	return record
+}
+
+// NewSink returns the sink described by the given URL. Supported URLs are:
+//
+//	file:///path/to/accessrequests.jsonl
+//	http(s)://collector.example.com/accessrequests
+//	s3://bucket/prefix?endpoint=https://s3.example.com&region=us-east-1
+func NewSink(rawURL string) (Sink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "file":
+		return newFileSink(u)
+	case "http", "https":
+		return newHTTPSink(u)
+	case "s3":
+		return newS3Sink(u)
+	default:
+		return nil, fmt.Errorf("unsupported archive sink scheme %q", u.Scheme)
+	}
+}
+
+// marshalLine encodes the record as a single JSON line
+func marshalLine(record *Record) ([]byte, error) {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	return append(line, '\n'), nil
+}
@@ -0,0 +1,63 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package archive
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"sync"
+)
+
+// fileSink appends records to a local file, which may be backed by a persistent volume
+type fileSink struct {
+	mu   sync.Mutex
+	path string
+}
+
+func newFileSink(u *url.URL) (*fileSink, error) {
+	if u.Path == "" {
+		return nil, errors.New("file archive sink requires a path")
+	}
+	return &fileSink{path: u.Path}, nil
+}
+
+func (s *fileSink) Write(ctx context.Context, record *Record) error {
+	line, err := marshalLine(record)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return err
+	}
+	// Ensure the record has been persisted before reporting success
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,75 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package archive
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+const (
+	// bearerTokenEnvVar is the environment variable holding the bearer token used to authenticate
+	// with an http collector
+	bearerTokenEnvVar = "ARCHIVE_BEARER_TOKEN"
+)
+
+// httpSink posts records to an http collector
+type httpSink struct {
+	url         string
+	bearerToken string
+	client      *http.Client
+}
+
+func newHTTPSink(u *url.URL) (*httpSink, error) {
+	return &httpSink{
+		url:         u.String(),
+		bearerToken: os.Getenv(bearerTokenEnvVar),
+		client:      &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (s *httpSink) Write(ctx context.Context, record *Record) error {
+	line, err := marshalLine(record)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(line))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if s.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+s.bearerToken)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("archive collector %s returned %s", s.url, resp.Status)
+	}
+	return nil
+}
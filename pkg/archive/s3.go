@@ -0,0 +1,196 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package archive
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	// accessKeyIDEnvVar and secretAccessKeyEnvVar are the environment variables holding the
+	// credentials used to authenticate with an s3-compatible endpoint. sessionTokenEnvVar holds the
+	// session token of temporary credentials, if any
+	accessKeyIDEnvVar     = "AWS_ACCESS_KEY_ID"
+	secretAccessKeyEnvVar = "AWS_SECRET_ACCESS_KEY"
+	sessionTokenEnvVar    = "AWS_SESSION_TOKEN"
+
+	defaultS3Region = "us-east-1"
+)
+
+// s3Sink writes each record as a separate object to an s3-compatible endpoint. Requests are signed
+// using AWS Signature Version 4 and buckets are addressed using path-style URLs so that non-AWS
+// implementations are supported
+type s3Sink struct {
+	endpoint        string
+	region          string
+	bucket          string
+	prefix          string
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+	client          *http.Client
+}
+
+func newS3Sink(u *url.URL) (*s3Sink, error) {
+	if u.Host == "" {
+		return nil, errors.New("s3 archive sink requires a bucket")
+	}
+
+	query := u.Query()
+	endpoint := query.Get("endpoint")
+	region := query.Get("region")
+	if region == "" {
+		region = defaultS3Region
+	}
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+
+	accessKeyID := os.Getenv(accessKeyIDEnvVar)
+	secretAccessKey := os.Getenv(secretAccessKeyEnvVar)
+	if accessKeyID == "" || secretAccessKey == "" {
+		return nil, fmt.Errorf("s3 archive sink requires %s and %s to be set", accessKeyIDEnvVar, secretAccessKeyEnvVar)
+	}
+
+	return &s3Sink{
+		endpoint:        strings.TrimSuffix(endpoint, "/"),
+		region:          region,
+		bucket:          u.Host,
+		prefix:          strings.Trim(u.Path, "/"),
+		accessKeyID:     accessKeyID,
+		secretAccessKey: secretAccessKey,
+		sessionToken:    os.Getenv(sessionTokenEnvVar),
+		client:          &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (s *s3Sink) Write(ctx context.Context, record *Record) error {
+	line, err := marshalLine(record)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, fmt.Sprintf("%s/%s/%s", s.endpoint, s.bucket, s.objectKey(record)), bytes.NewReader(line))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	s.sign(req, line, time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("s3 endpoint %s returned %s", s.endpoint, resp.Status)
+	}
+	return nil
+}
+
+// objectKey returns the key of the object storing the record. Objects are keyed by accessrequest so
+// that records can be found without listing the whole bucket, and by the time and reason of the
+// record so that records of the same accessrequest do not overwrite each other
+func (s *s3Sink) objectKey(record *Record) string {
+	accessRequest := record.AccessRequest
+	timestamp := record.ArchiveTime.UTC().Format("20060102T150405.000000000Z")
+	return path.Join(s.prefix, accessRequest.Namespace, accessRequest.Name, fmt.Sprintf("%s-%s-%s.jsonl", accessRequest.UID, timestamp, record.Reason))
+}
+
+// sign adds AWS Signature Version 4 headers to the request. The session token of temporary
+// credentials is sent in the X-Amz-Security-Token header, which is signed too
+func (s *s3Sink) sign(req *http.Request, body []byte, t time.Time) {
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	headers := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if s.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.sessionToken)
+		headers = append(headers, "x-amz-security-token")
+	}
+	signV4(req, headers, payloadHash, s.accessKeyID, s.secretAccessKey, s.region, "s3", t)
+}
+
+// signV4 signs the request for the given service using AWS Signature Version 4, setting the
+// X-Amz-Date and Authorization headers. The given headers are signed, in addition to X-Amz-Date,
+// and must be lower case and sorted
+// https://docs.aws.amazon.com/general/latest/gr/sigv4_signing.html
+func signV4(req *http.Request, headers []string, payloadHash, accessKeyID, secretAccessKey, region, service string, t time.Time) {
+	amzDate := t.Format("20060102T150405Z")
+	dateStamp := t.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	var canonicalHeaders strings.Builder
+	for _, header := range headers {
+		value := req.Header.Get(header)
+		if header == "host" {
+			value = req.URL.Host
+		}
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", header, strings.TrimSpace(value))
+	}
+	signedHeaders := strings.Join(headers, ";")
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", dateStamp, region, service)
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	signature := hex.EncodeToString(hmacSHA256(signingKey(secretAccessKey, dateStamp, region, service), stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", accessKeyID, scope, signedHeaders, signature))
+}
+
+// signingKey derives the key used to sign requests for the given service on the given date
+func signingKey(secretAccessKey, dateStamp, region, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), dateStamp)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
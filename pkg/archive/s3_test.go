@@ -0,0 +1,173 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package archive
+
+import (
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	iamv1alpha1 "github.com/dippynark/access-request-controller/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Credentials used by the AWS Signature Version 4 examples and test suite
+const (
+	exampleAccessKeyID     = "AKIDEXAMPLE"
+	exampleSecretAccessKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+)
+
+func TestSigningKey(t *testing.T) {
+	tests := []struct {
+		dateStamp string
+		region    string
+		service   string
+		want      string
+	}{
+		{
+			dateStamp: "20120215",
+			region:    "us-east-1",
+			service:   "iam",
+			want:      "f4780e2d9f65fa895f9c67b32ce1baf0b0d8a43505a000a1a9e090d414db404d",
+		},
+		{
+			dateStamp: "20150830",
+			region:    "us-east-1",
+			service:   "iam",
+			want:      "c4afb1cc5771d871763a393e44b703571b55cc28424d1a5e86da6ed3c154a4b9",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dateStamp+"/"+tt.region+"/"+tt.service, func(t *testing.T) {
+			if got := hex.EncodeToString(signingKey(exampleSecretAccessKey, tt.dateStamp, tt.region, tt.service)); got != tt.want {
+				t.Errorf("signingKey() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignV4(t *testing.T) {
+	// Requests from the AWS Signature Version 4 test suite
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		want   string
+	}{
+		{
+			name:   "get-vanilla",
+			method: http.MethodGet,
+			url:    "https://example.amazonaws.com/",
+			want:   "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name:   "post-vanilla",
+			method: http.MethodPost,
+			url:    "https://example.amazonaws.com/",
+			want:   "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			signV4(req, []string{"host", "x-amz-date"}, sha256Hex(nil), exampleAccessKeyID, exampleSecretAccessKey, "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+			if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+				t.Errorf("X-Amz-Date = %s, want 20150830T123600Z", got)
+			}
+			if got := req.Header.Get("Authorization"); got != tt.want {
+				t.Errorf("Authorization = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestS3SinkSign(t *testing.T) {
+	sink := &s3Sink{
+		region:          "eu-west-2",
+		accessKeyID:     exampleAccessKeyID,
+		secretAccessKey: exampleSecretAccessKey,
+	}
+	req, err := http.NewRequest(http.MethodPut, "https://s3.eu-west-2.amazonaws.com/bucket/default/example/uid-1.jsonl", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.sign(req, []byte("{}\n"), time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	if got, want := req.Header.Get("X-Amz-Content-Sha256"), sha256Hex([]byte("{}\n")); got != want {
+		t.Errorf("X-Amz-Content-Sha256 = %s, want %s", got, want)
+	}
+	prefix := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/eu-west-2/s3/aws4_request, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature="
+	if got := req.Header.Get("Authorization"); !strings.HasPrefix(got, prefix) {
+		t.Errorf("Authorization = %s, want prefix %s", got, prefix)
+	}
+}
+
+func TestS3SinkSignSessionToken(t *testing.T) {
+	sink := &s3Sink{
+		region:          "eu-west-2",
+		accessKeyID:     exampleAccessKeyID,
+		secretAccessKey: exampleSecretAccessKey,
+		sessionToken:    "session-token",
+	}
+	req, err := http.NewRequest(http.MethodPut, "https://s3.eu-west-2.amazonaws.com/bucket/default/example/uid-1.jsonl", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.sign(req, []byte("{}\n"), time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	if got := req.Header.Get("X-Amz-Security-Token"); got != "session-token" {
+		t.Errorf("X-Amz-Security-Token = %s, want session-token", got)
+	}
+	prefix := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/eu-west-2/s3/aws4_request, SignedHeaders=host;x-amz-content-sha256;x-amz-date;x-amz-security-token, Signature="
+	if got := req.Header.Get("Authorization"); !strings.HasPrefix(got, prefix) {
+		t.Errorf("Authorization = %s, want prefix %s", got, prefix)
+	}
+
+	// The session token is covered by the signature
+	unsigned, err := http.NewRequest(http.MethodPut, req.URL.String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	(&s3Sink{region: sink.region, accessKeyID: sink.accessKeyID, secretAccessKey: sink.secretAccessKey, sessionToken: "other-token"}).sign(unsigned, []byte("{}\n"), time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+	if req.Header.Get("Authorization") == unsigned.Header.Get("Authorization") {
+		t.Error("expected the signature to depend on the session token")
+	}
+}
+
+func TestS3SinkObjectKey(t *testing.T) {
+	sink := &s3Sink{prefix: "accessrequests"}
+	accessRequest := &iamv1alpha1.AccessRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: "example", Namespace: "default", UID: "1234"},
+	}
+	archiveTime := time.Date(2021, 3, 16, 16, 54, 36, 123456789, time.UTC)
+
+	expired := sink.objectKey(&Record{ArchiveTime: metav1.NewTime(archiveTime), Reason: "Expired", AccessRequest: accessRequest})
+	if want := "accessrequests/default/example/1234-20210316T165436.123456789Z-Expired.jsonl"; expired != want {
+		t.Errorf("got %s, want %s", expired, want)
+	}
+	// Records of the same accessrequest written within the same second are kept
+	deleted := sink.objectKey(&Record{ArchiveTime: metav1.NewTime(archiveTime), Reason: "Deleted", AccessRequest: accessRequest})
+	later := sink.objectKey(&Record{ArchiveTime: metav1.NewTime(archiveTime.Add(time.Millisecond)), Reason: "Expired", AccessRequest: accessRequest})
+	if deleted == expired || later == expired {
+		t.Errorf("expected distinct keys, got %s, %s and %s", expired, deleted, later)
+	}
+}
@@ -0,0 +1,211 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package catalog
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// authenticationConfigMapNamespace and authenticationConfigMapName identify the configmap in
+	// which the apiserver publishes how extension apiservers should authenticate proxied requests
+	authenticationConfigMapNamespace = "kube-system"
+	authenticationConfigMapName      = "extension-apiserver-authentication"
+
+	requestHeaderClientCAKey           = "requestheader-client-ca-file"
+	requestHeaderAllowedNamesKey       = "requestheader-allowed-names"
+	requestHeaderUsernameHeadersKey    = "requestheader-username-headers"
+	requestHeaderGroupHeadersKey       = "requestheader-group-headers"
+	requestHeaderExtraHeadersPrefixKey = "requestheader-extra-headers-prefix"
+
+	// authenticationConfigTTL is how long the authentication configuration is cached before it is
+	// read again, so that rotation of the front proxy CA is picked up
+	authenticationConfigTTL = 5 * time.Minute
+)
+
+// +kubebuilder:rbac:groups="",resources=configmaps,resourceNames=extension-apiserver-authentication,verbs=get
+
+// errUnauthenticated is returned when a request was not proxied by the apiserver
+var errUnauthenticated = errors.New("request was not proxied by the apiserver")
+
+// RequestHeaderAuthenticator authenticates requests proxied by the apiserver's aggregation layer.
+// The apiserver authenticates the user, identifies them in request headers and presents a client
+// certificate signed by its front proxy CA, so no user credentials reach the catalog
+type RequestHeaderAuthenticator struct {
+	Reader client.Reader
+
+	mu       sync.Mutex
+	config   *requestHeaderConfig
+	loadTime time.Time
+}
+
+// requestHeaderConfig is the request header configuration published by the apiserver
+type requestHeaderConfig struct {
+	clientCAs           *x509.CertPool
+	allowedNames        []string
+	usernameHeaders     []string
+	groupHeaders        []string
+	extraHeaderPrefixes []string
+}
+
+// VerifyProxy returns an error unless the request was made by the apiserver's front proxy
+func (a *RequestHeaderAuthenticator) VerifyProxy(req *http.Request) error {
+	config, err := a.loadConfig(req.Context())
+	if err != nil {
+		return err
+	}
+	return config.verifyProxy(req)
+}
+
+// Authenticate returns the user on whose behalf the apiserver proxied the request
+func (a *RequestHeaderAuthenticator) Authenticate(req *http.Request) (authenticationv1.UserInfo, error) {
+	config, err := a.loadConfig(req.Context())
+	if err != nil {
+		return authenticationv1.UserInfo{}, err
+	}
+	if err := config.verifyProxy(req); err != nil {
+		return authenticationv1.UserInfo{}, err
+	}
+	return config.user(req)
+}
+
+// loadConfig returns the cached request header configuration, reading it again once it expires
+func (a *RequestHeaderAuthenticator) loadConfig(ctx context.Context) (*requestHeaderConfig, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.config != nil && time.Since(a.loadTime) < authenticationConfigTTL {
+		return a.config, nil
+	}
+
+	configMap := &corev1.ConfigMap{}
+	if err := a.Reader.Get(ctx, types.NamespacedName{Namespace: authenticationConfigMapNamespace, Name: authenticationConfigMapName}, configMap); err != nil {
+		return nil, err
+	}
+	config, err := newRequestHeaderConfig(configMap)
+	if err != nil {
+		return nil, err
+	}
+	a.config, a.loadTime = config, time.Now()
+	return config, nil
+}
+
+// newRequestHeaderConfig parses the request header configuration published by the apiserver
+func newRequestHeaderConfig(configMap *corev1.ConfigMap) (*requestHeaderConfig, error) {
+	caBundle := configMap.Data[requestHeaderClientCAKey]
+	if caBundle == "" {
+		return nil, fmt.Errorf("%s/%s has no %s; the apiserver's aggregation layer is not configured", configMap.Namespace, configMap.Name, requestHeaderClientCAKey)
+	}
+	config := &requestHeaderConfig{clientCAs: x509.NewCertPool()}
+	if !config.clientCAs.AppendCertsFromPEM([]byte(caBundle)) {
+		return nil, fmt.Errorf("unable to parse %s of %s/%s", requestHeaderClientCAKey, configMap.Namespace, configMap.Name)
+	}
+	for key, value := range map[string]*[]string{
+		requestHeaderAllowedNamesKey:       &config.allowedNames,
+		requestHeaderUsernameHeadersKey:    &config.usernameHeaders,
+		requestHeaderGroupHeadersKey:       &config.groupHeaders,
+		requestHeaderExtraHeadersPrefixKey: &config.extraHeaderPrefixes,
+	} {
+		if configMap.Data[key] == "" {
+			continue
+		}
+		if err := json.Unmarshal([]byte(configMap.Data[key]), value); err != nil {
+			return nil, fmt.Errorf("unable to parse %s of %s/%s: %v", key, configMap.Namespace, configMap.Name, err)
+		}
+	}
+	if len(config.usernameHeaders) == 0 {
+		return nil, fmt.Errorf("%s/%s has no %s", configMap.Namespace, configMap.Name, requestHeaderUsernameHeadersKey)
+	}
+	return config, nil
+}
+
+// verifyProxy verifies that the client certificate of the request was issued by the front proxy CA
+// to one of the allowed names
+func (c *requestHeaderConfig) verifyProxy(req *http.Request) error {
+	if req.TLS == nil || len(req.TLS.PeerCertificates) == 0 {
+		return errUnauthenticated
+	}
+	intermediates := x509.NewCertPool()
+	for _, certificate := range req.TLS.PeerCertificates[1:] {
+		intermediates.AddCert(certificate)
+	}
+	certificate := req.TLS.PeerCertificates[0]
+	if _, err := certificate.Verify(x509.VerifyOptions{
+		Roots:         c.clientCAs,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}); err != nil {
+		return errUnauthenticated
+	}
+	if len(c.allowedNames) == 0 {
+		return nil
+	}
+	for _, name := range c.allowedNames {
+		if certificate.Subject.CommonName == name {
+			return nil
+		}
+	}
+	return errUnauthenticated
+}
+
+// user returns the user identified by the headers of a request made by the front proxy
+func (c *requestHeaderConfig) user(req *http.Request) (authenticationv1.UserInfo, error) {
+	user := authenticationv1.UserInfo{}
+	for _, header := range c.usernameHeaders {
+		if username := req.Header.Get(header); username != "" {
+			user.Username = username
+			break
+		}
+	}
+	if user.Username == "" {
+		return user, errUnauthenticated
+	}
+	for _, header := range c.groupHeaders {
+		user.Groups = append(user.Groups, req.Header.Values(header)...)
+	}
+	for header, values := range req.Header {
+		for _, prefix := range c.extraHeaderPrefixes {
+			if !strings.HasPrefix(strings.ToLower(header), strings.ToLower(prefix)) {
+				continue
+			}
+			// Extra keys are lowercased and percent-encoded by the front proxy
+			key, err := url.PathUnescape(strings.ToLower(header[len(prefix):]))
+			if err != nil {
+				continue
+			}
+			if user.Extra == nil {
+				user.Extra = map[string]authenticationv1.ExtraValue{}
+			}
+			user.Extra[key] = append(user.Extra[key], values...)
+			break
+		}
+	}
+	return user, nil
+}
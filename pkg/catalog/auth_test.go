@@ -0,0 +1,175 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package catalog
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// newTestCertificate returns a certificate for the given common name signed by the given parent,
+// or self-signed if the parent is nil
+func newTestCertificate(t *testing.T, commonName string, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if isCA {
+		template.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestRequestHeaderAuthentication(t *testing.T) {
+	ca, caKey := newTestCertificate(t, "front-proxy-ca", true, nil, nil)
+	otherCA, otherCAKey := newTestCertificate(t, "other-ca", true, nil, nil)
+	frontProxy, _ := newTestCertificate(t, "front-proxy-client", false, ca, caKey)
+	otherClient, _ := newTestCertificate(t, "other-client", false, ca, caKey)
+	forged, _ := newTestCertificate(t, "front-proxy-client", false, otherCA, otherCAKey)
+
+	config, err := newRequestHeaderConfig(&corev1.ConfigMap{
+		Data: map[string]string{
+			requestHeaderClientCAKey:           string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})),
+			requestHeaderAllowedNamesKey:       `["front-proxy-client"]`,
+			requestHeaderUsernameHeadersKey:    `["X-Remote-User"]`,
+			requestHeaderGroupHeadersKey:       `["X-Remote-Group"]`,
+			requestHeaderExtraHeadersPrefixKey: `["X-Remote-Extra-"]`,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		certificate *x509.Certificate
+		headers     map[string][]string
+		want        authenticationv1.UserInfo
+		wantErr     bool
+	}{
+		{
+			name:        "proxied request",
+			certificate: frontProxy,
+			headers: map[string][]string{
+				"X-Remote-User":                     {"alice"},
+				"X-Remote-Group":                    {"developers", "system:authenticated"},
+				"X-Remote-Extra-Scopes":             {"view"},
+				"X-Remote-Extra-Example.com%2fteam": {"payments"},
+			},
+			want: authenticationv1.UserInfo{
+				Username: "alice",
+				Groups:   []string{"developers", "system:authenticated"},
+				Extra: map[string]authenticationv1.ExtraValue{
+					"scopes":           {"view"},
+					"example.com/team": {"payments"},
+				},
+			},
+		},
+		{
+			name:    "no client certificate",
+			headers: map[string][]string{"X-Remote-User": {"alice"}},
+			wantErr: true,
+		},
+		{
+			name:        "client certificate signed by another CA",
+			certificate: forged,
+			headers:     map[string][]string{"X-Remote-User": {"alice"}},
+			wantErr:     true,
+		},
+		{
+			name:        "client name not allowed",
+			certificate: otherClient,
+			headers:     map[string][]string{"X-Remote-User": {"alice"}},
+			wantErr:     true,
+		},
+		{
+			name:        "no user",
+			certificate: frontProxy,
+			wantErr:     true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, Path+"/"+Resource, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.TLS = &tls.ConnectionState{}
+			if test.certificate != nil {
+				req.TLS.PeerCertificates = []*x509.Certificate{test.certificate}
+			}
+			for header, values := range test.headers {
+				for _, value := range values {
+					req.Header.Add(header, value)
+				}
+			}
+
+			err = config.verifyProxy(req)
+			var user authenticationv1.UserInfo
+			if err == nil {
+				user, err = config.user(req)
+			}
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected request to be rejected, got user %+v", user)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(user, test.want) {
+				t.Errorf("got %+v, want %+v", user, test.want)
+			}
+		})
+	}
+}
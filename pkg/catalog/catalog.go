@@ -0,0 +1,246 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package catalog lists the roles that users may request through accessrequests
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	iamv1alpha1 "github.com/dippynark/access-request-controller/api/v1alpha1"
+	"github.com/go-logr/logr"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const accessRequestResourcePlural = "accessrequests"
+
+const (
+	// GroupName is the API group under which the apiserver's aggregation layer serves the catalog
+	GroupName = "catalog.iam.dippynark.co.uk"
+	// Version is the version of the catalog API
+	Version = "v1alpha1"
+	// Path is the path of the catalog API group version
+	Path = "/apis/" + GroupName + "/" + Version
+	// Resource is the resource under which the catalog lists requestable roles
+	Resource = "requestableroles"
+	// Kind is the kind of the entries of the catalog
+	Kind = "RequestableRole"
+)
+
+// GroupVersion is the API group version of the catalog
+var GroupVersion = schema.GroupVersion{Group: GroupName, Version: Version}
+
+// Entry is a role that can be requested in a namespace
+type Entry struct {
+	Namespace     string `json:"namespace"`
+	Kind          string `json:"kind"`
+	Name          string `json:"name"`
+	Description   string `json:"description,omitempty"`
+	Owner         string `json:"owner,omitempty"`
+	MaxDuration   string `json:"maxDuration,omitempty"`
+	ApproverGroup string `json:"approverGroup,omitempty"`
+}
+
+// List is the response of the catalog endpoint
+type List struct {
+	metav1.TypeMeta `json:",inline"`
+	Items           []Entry `json:"items"`
+}
+
+// Catalog lists requestable roles
+type Catalog struct {
+	Client client.Client
+}
+
+// Entries returns the requestable roles in each namespace in which the given user may create
+// accessrequests. If a namespace is given, only roles requestable in that namespace are returned
+func (c *Catalog) Entries(ctx context.Context, user authenticationv1.UserInfo, namespace string) ([]Entry, error) {
+	requestable := client.MatchingLabels{iamv1alpha1.RequestableLabel: "true"}
+	clusterRoleList := &rbacv1.ClusterRoleList{}
+	if err := c.Client.List(ctx, clusterRoleList, requestable); err != nil {
+		return nil, err
+	}
+	roleList := &rbacv1.RoleList{}
+	if err := c.Client.List(ctx, roleList, requestable); err != nil {
+		return nil, err
+	}
+	namespaceList := &corev1.NamespaceList{}
+	if err := c.Client.List(ctx, namespaceList); err != nil {
+		return nil, err
+	}
+	if namespace != "" {
+		namespaces := []corev1.Namespace{}
+		for _, item := range namespaceList.Items {
+			if item.Name == namespace {
+				namespaces = append(namespaces, item)
+			}
+		}
+		namespaceList.Items = namespaces
+	}
+	sort.Slice(namespaceList.Items, func(i, j int) bool {
+		return namespaceList.Items[i].Name < namespaceList.Items[j].Name
+	})
+
+	entries := []Entry{}
+	for _, namespace := range namespaceList.Items {
+		allowed, err := c.canRequest(ctx, user, namespace.Name)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			continue
+		}
+		for _, clusterRole := range clusterRoleList.Items {
+			entries = append(entries, newEntry(namespace.Name, "ClusterRole", clusterRole.ObjectMeta))
+		}
+		for _, role := range roleList.Items {
+			if role.Namespace == namespace.Name {
+				entries = append(entries, newEntry(namespace.Name, "Role", role.ObjectMeta))
+			}
+		}
+	}
+	return entries, nil
+}
+
+// canRequest returns whether the user may create accessrequests in the given namespace
+func (c *Catalog) canRequest(ctx context.Context, user authenticationv1.UserInfo, namespace string) (bool, error) {
+	extra := map[string]authv1.ExtraValue{}
+	for k, v := range user.Extra {
+		extra[k] = authv1.ExtraValue(v)
+	}
+	sar := &authv1.SubjectAccessReview{
+		Spec: authv1.SubjectAccessReviewSpec{
+			User:   user.Username,
+			Groups: user.Groups,
+			Extra:  extra,
+			UID:    user.UID,
+			ResourceAttributes: &authv1.ResourceAttributes{
+				Namespace: namespace,
+				Verb:      "create",
+				Group:     iamv1alpha1.GroupVersion.Group,
+				Version:   iamv1alpha1.GroupVersion.Version,
+				Resource:  accessRequestResourcePlural,
+			},
+		},
+	}
+	if err := c.Client.Create(ctx, sar); err != nil {
+		return false, err
+	}
+	return sar.Status.Allowed && !sar.Status.Denied, nil
+}
+
+func newEntry(namespace, kind string, objectMeta metav1.ObjectMeta) Entry {
+	return Entry{
+		Namespace:     namespace,
+		Kind:          kind,
+		Name:          objectMeta.Name,
+		Description:   objectMeta.Annotations[iamv1alpha1.DescriptionAnnotation],
+		Owner:         objectMeta.Annotations[iamv1alpha1.OwnerAnnotation],
+		MaxDuration:   objectMeta.Annotations[iamv1alpha1.MaxDurationAnnotation],
+		ApproverGroup: objectMeta.Annotations[iamv1alpha1.ApproverGroupAnnotation],
+	}
+}
+
+// Handler serves the catalog as an aggregated API, listing the requestable roles of the user on
+// whose behalf the apiserver proxied the request
+type Handler struct {
+	Catalog       *Catalog
+	Authenticator *RequestHeaderAuthenticator
+	Log           logr.Logger
+}
+
+// ServeHTTP responds to discovery of the catalog API group version and to lists of requestable
+// roles, in all namespaces or in the namespace of the path
+func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	path := strings.TrimSuffix(req.URL.Path, "/")
+	if path == Path {
+		// The apiserver discovers the API without identifying a user
+		if err := h.Authenticator.VerifyProxy(req); err != nil {
+			h.unauthorized(w, err)
+			return
+		}
+		h.write(w, &metav1.APIResourceList{
+			TypeMeta:     metav1.TypeMeta{Kind: "APIResourceList", APIVersion: "v1"},
+			GroupVersion: GroupVersion.String(),
+			APIResources: []metav1.APIResource{{
+				Name:       Resource,
+				Namespaced: true,
+				Kind:       Kind,
+				Verbs:      metav1.Verbs{"list"},
+			}},
+		})
+		return
+	}
+
+	var namespace string
+	switch parts := strings.Split(strings.TrimPrefix(path, Path+"/"), "/"); {
+	case len(parts) == 1 && parts[0] == Resource:
+	case len(parts) == 3 && parts[0] == "namespaces" && parts[1] != "" && parts[2] == Resource:
+		namespace = parts[1]
+	default:
+		http.NotFound(w, req)
+		return
+	}
+
+	user, err := h.Authenticator.Authenticate(req)
+	if err != nil {
+		h.unauthorized(w, err)
+		return
+	}
+	entries, err := h.Catalog.Entries(req.Context(), user, namespace)
+	if err != nil {
+		h.Log.Error(err, "unable to list catalog", "user", user.Username)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.write(w, &List{
+		TypeMeta: metav1.TypeMeta{Kind: Kind + "List", APIVersion: GroupVersion.String()},
+		Items:    entries,
+	})
+}
+
+// unauthorized responds to a request that could not be authenticated
+func (h *Handler) unauthorized(w http.ResponseWriter, err error) {
+	if err != errUnauthenticated {
+		h.Log.Error(err, "unable to authenticate request")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Error(w, "unauthorized", http.StatusUnauthorized)
+}
+
+// write responds with the given object encoded as JSON
+func (h *Handler) write(w http.ResponseWriter, obj interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(obj); err != nil {
+		h.Log.Error(err, "unable to write response")
+	}
+}
@@ -0,0 +1,72 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package catalog
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+
+	"sigs.k8s.io/controller-runtime/pkg/certwatcher"
+)
+
+// Server serves the catalog handler to the apiserver's aggregation layer from the controller
+// manager. It requests, but does not itself verify, client certificates so that the handler can
+// verify them against the front proxy CA published by the apiserver
+type Server struct {
+	Handler  http.Handler
+	Port     int
+	CertFile string
+	KeyFile  string
+}
+
+// Start serves the catalog until the context is cancelled
+func (s *Server) Start(ctx context.Context) error {
+	certWatcher, err := certwatcher.New(s.CertFile, s.KeyFile)
+	if err != nil {
+		return err
+	}
+	go func() {
+		_ = certWatcher.Start(ctx)
+	}()
+
+	mux := http.NewServeMux()
+	mux.Handle(Path, s.Handler)
+	mux.Handle(Path+"/", s.Handler)
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%d", s.Port),
+		Handler: mux,
+		TLSConfig: &tls.Config{
+			GetCertificate: certWatcher.GetCertificate,
+			ClientAuth:     tls.RequestClientCert,
+		},
+	}
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+	if err := server.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// NeedLeaderElection returns false so that every replica of the manager serves the catalog
+func (s *Server) NeedLeaderElection() bool {
+	return false
+}
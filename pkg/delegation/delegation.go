@@ -0,0 +1,83 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package delegation resolves the approval rights that approvers have delegated to other users
+// through approverdelegations
+package delegation
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	iamv1alpha1 "github.com/dippynark/access-request-controller/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// +kubebuilder:rbac:groups=iam.dippynark.co.uk,resources=approverdelegations,verbs=get;list;watch
+
+// Active returns whether the delegation is in effect at the given time. Delegations without a start
+// time start when they are created
+func Active(delegation *iamv1alpha1.ApproverDelegation, at time.Time) bool {
+	start := delegation.CreationTimestamp.Time
+	if delegation.Spec.StartTime != nil {
+		start = delegation.Spec.StartTime.Time
+	}
+	return !at.Before(start) && at.Before(delegation.Spec.EndTime.Time)
+}
+
+// Delegators returns the approvers who have delegated their approval rights to the given user at
+// the given time
+func Delegators(ctx context.Context, c client.Reader, delegate string, at time.Time) ([]string, error) {
+	delegationList := &iamv1alpha1.ApproverDelegationList{}
+	if err := c.List(ctx, delegationList); err != nil {
+		return nil, err
+	}
+	delegators := []string{}
+	seen := map[string]bool{}
+	for i := range delegationList.Items {
+		delegation := &delegationList.Items[i]
+		if delegation.Spec.Delegate != delegate || !Active(delegation, at) || seen[delegation.Spec.Delegator] {
+			continue
+		}
+		seen[delegation.Spec.Delegator] = true
+		delegators = append(delegators, delegation.Spec.Delegator)
+	}
+	return delegators, nil
+}
+
+// Delegated returns whether the delegator had delegated their approval rights to the delegate at
+// the given time
+func Delegated(ctx context.Context, c client.Reader, delegator, delegate string, at time.Time) (bool, error) {
+	delegators, err := Delegators(ctx, c, delegate, at)
+	if err != nil {
+		return false, err
+	}
+	for _, d := range delegators {
+		if d == delegator {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Describe returns a description of who made the approval, for example "bob on behalf of alice"
+func Describe(approval iamv1alpha1.Approval) string {
+	if approval.Delegator == "" {
+		return approval.User
+	}
+	return fmt.Sprintf("%s on behalf of %s", approval.User, approval.Delegator)
+}
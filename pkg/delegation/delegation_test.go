@@ -0,0 +1,102 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package delegation
+
+import (
+	"testing"
+	"time"
+
+	iamv1alpha1 "github.com/dippynark/access-request-controller/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestActive(t *testing.T) {
+	created := time.Date(2021, 3, 1, 9, 0, 0, 0, time.UTC)
+	start := created.Add(time.Hour)
+	earlyStart := created.Add(-time.Hour)
+	end := created.Add(24 * time.Hour)
+
+	tests := []struct {
+		name      string
+		startTime *time.Time
+		at        time.Time
+		want      bool
+	}{
+		{
+			name: "before creation without start time",
+			at:   created.Add(-time.Second),
+			want: false,
+		},
+		{
+			name: "at creation without start time",
+			at:   created,
+			want: true,
+		},
+		{
+			name:      "before start time",
+			startTime: &start,
+			at:        start.Add(-time.Second),
+			want:      false,
+		},
+		{
+			name:      "at start time",
+			startTime: &start,
+			at:        start,
+			want:      true,
+		},
+		{
+			name:      "start time before creation",
+			startTime: &earlyStart,
+			at:        created.Add(-time.Minute),
+			want:      true,
+		},
+		{
+			name: "before end time",
+			at:   end.Add(-time.Second),
+			want: true,
+		},
+		{
+			name: "at end time",
+			at:   end,
+			want: false,
+		},
+		{
+			name: "after end time",
+			at:   end.Add(time.Second),
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delegation := &iamv1alpha1.ApproverDelegation{
+				ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(created)},
+				Spec: iamv1alpha1.ApproverDelegationSpec{
+					Delegator: "alice",
+					Delegate:  "bob",
+					EndTime:   metav1.NewTime(end),
+				},
+			}
+			if tt.startTime != nil {
+				startTime := metav1.NewTime(*tt.startTime)
+				delegation.Spec.StartTime = &startTime
+			}
+			if got := Active(delegation, tt.at); got != tt.want {
+				t.Errorf("Active() at %s = %v, want %v", tt.at, got, tt.want)
+			}
+		})
+	}
+}
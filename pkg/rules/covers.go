@@ -0,0 +1,137 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rules
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+// Hash returns a hash of the given rules which changes whenever the rules do. The order of the
+// rules and of the values within each rule does not affect the hash
+func Hash(rules []rbacv1.PolicyRule) string {
+	encodedRules := []string{}
+	for _, rule := range rules {
+		var encodedRule strings.Builder
+		for _, values := range [][]string{rule.Verbs, rule.APIGroups, rule.Resources, rule.ResourceNames, rule.NonResourceURLs} {
+			sortedValues := append([]string{}, values...)
+			sort.Strings(sortedValues)
+			fmt.Fprintf(&encodedRule, "%q;", sortedValues)
+		}
+		encodedRules = append(encodedRules, encodedRule.String())
+	}
+	sort.Strings(encodedRules)
+
+	hasher := sha256.New()
+	for _, encodedRule := range encodedRules {
+		fmt.Fprintf(hasher, "%s\n", encodedRule)
+	}
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// Covers returns whether every permission granted by the given rules is also granted by the owner
+// rules, meaning that replacing the owner rules by the given rules does not broaden access
+func Covers(ownerRules, rules []rbacv1.PolicyRule) bool {
+	for _, rule := range rules {
+		for _, permission := range breakdown(rule) {
+			covered := false
+			for _, ownerRule := range ownerRules {
+				if ruleCovers(ownerRule, permission) {
+					covered = true
+					break
+				}
+			}
+			if !covered {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// breakdown splits the given rule into rules that each grant a single verb on a single resource,
+// resource name or non-resource URL
+func breakdown(rule rbacv1.PolicyRule) []rbacv1.PolicyRule {
+	permissions := []rbacv1.PolicyRule{}
+	for _, verb := range rule.Verbs {
+		for _, url := range rule.NonResourceURLs {
+			permissions = append(permissions, rbacv1.PolicyRule{Verbs: []string{verb}, NonResourceURLs: []string{url}})
+		}
+		for _, apiGroup := range rule.APIGroups {
+			for _, resource := range rule.Resources {
+				permission := rbacv1.PolicyRule{Verbs: []string{verb}, APIGroups: []string{apiGroup}, Resources: []string{resource}}
+				if len(rule.ResourceNames) == 0 {
+					permissions = append(permissions, permission)
+					continue
+				}
+				for _, resourceName := range rule.ResourceNames {
+					permission.ResourceNames = []string{resourceName}
+					permissions = append(permissions, permission)
+				}
+			}
+		}
+	}
+	return permissions
+}
+
+// ruleCovers returns whether the owner rule grants the given permission, as returned by breakdown
+func ruleCovers(ownerRule, permission rbacv1.PolicyRule) bool {
+	if !matches(ownerRule.Verbs, permission.Verbs[0]) {
+		return false
+	}
+
+	if len(permission.NonResourceURLs) > 0 {
+		url := permission.NonResourceURLs[0]
+		for _, ownerURL := range ownerRule.NonResourceURLs {
+			if ownerURL == url || ownerURL == rbacv1.NonResourceAll {
+				return true
+			}
+			if strings.HasSuffix(ownerURL, "*") && strings.HasPrefix(url, strings.TrimSuffix(ownerURL, "*")) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if !matches(ownerRule.APIGroups, permission.APIGroups[0]) {
+		return false
+	}
+	if !resourceMatches(ownerRule.Resources, permission.Resources[0]) {
+		return false
+	}
+	if len(ownerRule.ResourceNames) == 0 {
+		return true
+	}
+	return len(permission.ResourceNames) > 0 && contains(ownerRule.ResourceNames, permission.ResourceNames[0])
+}
+
+// resourceMatches returns whether the given rule resources match the given resource, including by
+// wildcard or by a wildcard subresource such as */scale
+func resourceMatches(resources []string, resource string) bool {
+	if matches(resources, resource) {
+		return true
+	}
+	if i := strings.Index(resource, "/"); i >= 0 {
+		return contains(resources, "*"+resource[i:])
+	}
+	return false
+}
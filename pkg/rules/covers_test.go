@@ -0,0 +1,200 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rules
+
+import (
+	"testing"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+func TestHash(t *testing.T) {
+	podsRule := rbacv1.PolicyRule{Verbs: []string{"get", "list"}, APIGroups: []string{""}, Resources: []string{"pods", "pods/log"}}
+	deploymentsRule := rbacv1.PolicyRule{Verbs: []string{"get"}, APIGroups: []string{"apps"}, Resources: []string{"deployments"}}
+
+	tests := []struct {
+		name  string
+		rules []rbacv1.PolicyRule
+		other []rbacv1.PolicyRule
+		equal bool
+	}{
+		{
+			name:  "same rules",
+			rules: []rbacv1.PolicyRule{podsRule, deploymentsRule},
+			other: []rbacv1.PolicyRule{podsRule, deploymentsRule},
+			equal: true,
+		},
+		{
+			name:  "reordered rules",
+			rules: []rbacv1.PolicyRule{podsRule, deploymentsRule},
+			other: []rbacv1.PolicyRule{deploymentsRule, podsRule},
+			equal: true,
+		},
+		{
+			name:  "reordered values",
+			rules: []rbacv1.PolicyRule{podsRule},
+			other: []rbacv1.PolicyRule{{Verbs: []string{"list", "get"}, APIGroups: []string{""}, Resources: []string{"pods/log", "pods"}}},
+			equal: true,
+		},
+		{
+			name:  "empty and nil rules",
+			rules: []rbacv1.PolicyRule{},
+			other: nil,
+			equal: true,
+		},
+		{
+			name:  "added verb",
+			rules: []rbacv1.PolicyRule{podsRule},
+			other: []rbacv1.PolicyRule{{Verbs: []string{"get", "list", "delete"}, APIGroups: []string{""}, Resources: []string{"pods", "pods/log"}}},
+		},
+		{
+			name:  "added rule",
+			rules: []rbacv1.PolicyRule{podsRule},
+			other: []rbacv1.PolicyRule{podsRule, deploymentsRule},
+		},
+		{
+			name:  "value moved between fields",
+			rules: []rbacv1.PolicyRule{{Verbs: []string{"get"}, Resources: []string{"pods"}}},
+			other: []rbacv1.PolicyRule{{Verbs: []string{"get"}, ResourceNames: []string{"pods"}}},
+		},
+		{
+			name:  "values moved between rules",
+			rules: []rbacv1.PolicyRule{{Verbs: []string{"get", "list"}, Resources: []string{"pods"}}, {Verbs: []string{"get"}, Resources: []string{"secrets"}}},
+			other: []rbacv1.PolicyRule{{Verbs: []string{"get"}, Resources: []string{"pods"}}, {Verbs: []string{"get", "list"}, Resources: []string{"secrets"}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if equal := Hash(tt.rules) == Hash(tt.other); equal != tt.equal {
+				t.Errorf("Hash(%v) == Hash(%v) is %v, want %v", tt.rules, tt.other, equal, tt.equal)
+			}
+		})
+	}
+}
+
+func TestCovers(t *testing.T) {
+	tests := []struct {
+		name       string
+		ownerRules []rbacv1.PolicyRule
+		rules      []rbacv1.PolicyRule
+		want       bool
+	}{
+		{
+			name:       "no rules",
+			ownerRules: nil,
+			rules:      nil,
+			want:       true,
+		},
+		{
+			name:       "identical rules",
+			ownerRules: []rbacv1.PolicyRule{{Verbs: []string{"get", "list"}, APIGroups: []string{""}, Resources: []string{"pods"}}},
+			rules:      []rbacv1.PolicyRule{{Verbs: []string{"get", "list"}, APIGroups: []string{""}, Resources: []string{"pods"}}},
+			want:       true,
+		},
+		{
+			name:       "narrower verbs",
+			ownerRules: []rbacv1.PolicyRule{{Verbs: []string{"get", "list"}, APIGroups: []string{""}, Resources: []string{"pods"}}},
+			rules:      []rbacv1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods"}}},
+			want:       true,
+		},
+		{
+			name:       "additional verb",
+			ownerRules: []rbacv1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods"}}},
+			rules:      []rbacv1.PolicyRule{{Verbs: []string{"get", "delete"}, APIGroups: []string{""}, Resources: []string{"pods"}}},
+			want:       false,
+		},
+		{
+			name:       "permissions split across owner rules",
+			ownerRules: []rbacv1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods"}}, {Verbs: []string{"list"}, APIGroups: []string{""}, Resources: []string{"pods"}}},
+			rules:      []rbacv1.PolicyRule{{Verbs: []string{"get", "list"}, APIGroups: []string{""}, Resources: []string{"pods"}}},
+			want:       true,
+		},
+		{
+			name:       "wildcard verbs",
+			ownerRules: []rbacv1.PolicyRule{{Verbs: []string{"*"}, APIGroups: []string{""}, Resources: []string{"pods"}}},
+			rules:      []rbacv1.PolicyRule{{Verbs: []string{"delete"}, APIGroups: []string{""}, Resources: []string{"pods"}}},
+			want:       true,
+		},
+		{
+			name:       "wildcard resources",
+			ownerRules: []rbacv1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{"apps"}, Resources: []string{"*"}}},
+			rules:      []rbacv1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{"apps"}, Resources: []string{"deployments", "deployments/scale"}}},
+			want:       true,
+		},
+		{
+			name:       "wildcard subresource",
+			ownerRules: []rbacv1.PolicyRule{{Verbs: []string{"update"}, APIGroups: []string{"apps"}, Resources: []string{"*/scale"}}},
+			rules:      []rbacv1.PolicyRule{{Verbs: []string{"update"}, APIGroups: []string{"apps"}, Resources: []string{"deployments/scale"}}},
+			want:       true,
+		},
+		{
+			name:       "wildcard subresource does not cover resource",
+			ownerRules: []rbacv1.PolicyRule{{Verbs: []string{"update"}, APIGroups: []string{"apps"}, Resources: []string{"*/scale"}}},
+			rules:      []rbacv1.PolicyRule{{Verbs: []string{"update"}, APIGroups: []string{"apps"}, Resources: []string{"deployments"}}},
+			want:       false,
+		},
+		{
+			name:       "different API group",
+			ownerRules: []rbacv1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"deployments"}}},
+			rules:      []rbacv1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{"apps"}, Resources: []string{"deployments"}}},
+			want:       false,
+		},
+		{
+			name:       "resource names narrow access",
+			ownerRules: []rbacv1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"configmaps"}}},
+			rules:      []rbacv1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"configmaps"}, ResourceNames: []string{"settings"}}},
+			want:       true,
+		},
+		{
+			name:       "removing resource names broadens access",
+			ownerRules: []rbacv1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"configmaps"}, ResourceNames: []string{"settings"}}},
+			rules:      []rbacv1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"configmaps"}}},
+			want:       false,
+		},
+		{
+			name:       "additional resource name",
+			ownerRules: []rbacv1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"configmaps"}, ResourceNames: []string{"settings"}}},
+			rules:      []rbacv1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"configmaps"}, ResourceNames: []string{"settings", "credentials"}}},
+			want:       false,
+		},
+		{
+			name:       "non-resource URL prefix",
+			ownerRules: []rbacv1.PolicyRule{{Verbs: []string{"get"}, NonResourceURLs: []string{"/healthz/*"}}},
+			rules:      []rbacv1.PolicyRule{{Verbs: []string{"get"}, NonResourceURLs: []string{"/healthz/ready"}}},
+			want:       true,
+		},
+		{
+			name:       "different non-resource URL",
+			ownerRules: []rbacv1.PolicyRule{{Verbs: []string{"get"}, NonResourceURLs: []string{"/healthz"}}},
+			rules:      []rbacv1.PolicyRule{{Verbs: []string{"get"}, NonResourceURLs: []string{"/metrics"}}},
+			want:       false,
+		},
+		{
+			name:       "resource rules do not cover non-resource URLs",
+			ownerRules: []rbacv1.PolicyRule{{Verbs: []string{"*"}, APIGroups: []string{"*"}, Resources: []string{"*"}}},
+			rules:      []rbacv1.PolicyRule{{Verbs: []string{"get"}, NonResourceURLs: []string{"/metrics"}}},
+			want:       false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Covers(tt.ownerRules, tt.rules); got != tt.want {
+				t.Errorf("Covers(%v, %v) = %v, want %v", tt.ownerRules, tt.rules, got, tt.want)
+			}
+		})
+	}
+}
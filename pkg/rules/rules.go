@@ -0,0 +1,178 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package rules analyses the RBAC policy rules granted by accessrequests for privileges that warrant
+// additional scrutiny from approvers and auditors
+package rules
+
+import (
+	"fmt"
+	"strings"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+// Risk identifies a kind of risky privilege
+type Risk string
+
+const (
+	// WildcardVerbs means a rule grants all verbs on some resources
+	WildcardVerbs Risk = "WildcardVerbs"
+	// WildcardResources means a rule grants access to all resources in some API groups
+	WildcardResources Risk = "WildcardResources"
+	// Secrets means a rule grants access to secrets
+	Secrets Risk = "Secrets"
+	// Escalate means a rule allows roles to be granted permissions the holder does not have
+	Escalate Risk = "Escalate"
+	// Bind means a rule allows roles to be bound that grant permissions the holder does not have
+	Bind Risk = "Bind"
+	// Impersonate means a rule allows the holder to act as other users, groups or service accounts
+	Impersonate Risk = "Impersonate"
+	// Exec means a rule allows the holder to run commands in or attach to containers
+	Exec Risk = "Exec"
+	// Nodes means a rule grants access to nodes, including the kubelet API through nodes/proxy
+	Nodes Risk = "Nodes"
+)
+
+// risks lists the risks in the order findings are returned
+var risks = []Risk{WildcardVerbs, WildcardResources, Secrets, Escalate, Bind, Impersonate, Exec, Nodes}
+
+// weights are the contributions of each risk to the risk score
+var weights = map[Risk]int{
+	WildcardVerbs:     30,
+	WildcardResources: 30,
+	Secrets:           20,
+	Escalate:          40,
+	Bind:              40,
+	Impersonate:       50,
+	Exec:              20,
+	Nodes:             20,
+}
+
+// MaxScore is the highest risk score
+const MaxScore = 100
+
+// Finding describes a risky privilege granted by a set of rules
+type Finding struct {
+	Risk    Risk
+	Message string
+}
+
+// Analyze returns the risky privileges granted by the given rules, at most one finding per risk, in
+// the order the risks are declared
+func Analyze(rules []rbacv1.PolicyRule) []Finding {
+	messages := map[Risk]string{}
+	for _, rule := range rules {
+		// Non-resource rules, such as access to /metrics, are not analysed
+		if len(rule.Resources) == 0 {
+			continue
+		}
+		if contains(rule.Verbs, rbacv1.VerbAll) {
+			messages[WildcardVerbs] = fmt.Sprintf("grants all verbs on resources %v in API groups %v", rule.Resources, rule.APIGroups)
+		}
+		if contains(rule.Resources, rbacv1.ResourceAll) {
+			messages[WildcardResources] = fmt.Sprintf("grants %v on all resources in API groups %v", rule.Verbs, rule.APIGroups)
+		}
+		if matches(rule.APIGroups, "") && matches(rule.Resources, "secrets") {
+			messages[Secrets] = fmt.Sprintf("grants %v on secrets", rule.Verbs)
+		}
+		if matches(rule.APIGroups, rbacv1.GroupName) && (matches(rule.Resources, "roles") || matches(rule.Resources, "clusterroles")) {
+			if matches(rule.Verbs, "escalate") {
+				messages[Escalate] = "grants the escalate verb on roles"
+			}
+			if matches(rule.Verbs, "bind") {
+				messages[Bind] = "grants the bind verb on roles"
+			}
+		}
+		if matches(rule.Verbs, "impersonate") && (matches(rule.Resources, "users") || matches(rule.Resources, "groups") || matches(rule.Resources, "serviceaccounts")) {
+			messages[Impersonate] = "grants the impersonate verb on users, groups or service accounts"
+		}
+		if matches(rule.APIGroups, "") && (matches(rule.Resources, "pods/exec") || matches(rule.Resources, "pods/attach")) {
+			messages[Exec] = fmt.Sprintf("grants %v on pods/exec or pods/attach", rule.Verbs)
+		}
+		if matches(rule.APIGroups, "") && (matches(rule.Resources, "nodes") || matches(rule.Resources, "nodes/proxy")) {
+			messages[Nodes] = fmt.Sprintf("grants %v on nodes", rule.Verbs)
+		}
+	}
+
+	findings := []Finding{}
+	for _, risk := range risks {
+		if message, ok := messages[risk]; ok {
+			findings = append(findings, Finding{Risk: risk, Message: message})
+		}
+	}
+	return findings
+}
+
+// Score returns the risk score of the given findings, from 0 for no risky privileges up to
+// MaxScore. Each risk contributes its weight once
+func Score(findings []Finding) int {
+	score := 0
+	seen := map[Risk]bool{}
+	for _, finding := range findings {
+		if !seen[finding.Risk] {
+			seen[finding.Risk] = true
+			score += weights[finding.Risk]
+		}
+	}
+	if score > MaxScore {
+		return MaxScore
+	}
+	return score
+}
+
+// Summarize returns a human-readable description of each of the given rules, for example
+// "get, list on pods, pods/log"
+func Summarize(rules []rbacv1.PolicyRule) []string {
+	summary := []string{}
+	for _, rule := range rules {
+		verbs := strings.Join(rule.Verbs, ", ")
+		if len(rule.NonResourceURLs) > 0 {
+			summary = append(summary, fmt.Sprintf("%s on %s", verbs, strings.Join(rule.NonResourceURLs, ", ")))
+			continue
+		}
+
+		resources := []string{}
+		for _, apiGroup := range rule.APIGroups {
+			for _, resource := range rule.Resources {
+				if apiGroup != "" {
+					resource = fmt.Sprintf("%s.%s", resource, apiGroup)
+				}
+				resources = append(resources, resource)
+			}
+		}
+		description := fmt.Sprintf("%s on %s", verbs, strings.Join(resources, ", "))
+		if len(rule.ResourceNames) > 0 {
+			description = fmt.Sprintf("%s named %s", description, strings.Join(rule.ResourceNames, ", "))
+		}
+		summary = append(summary, description)
+	}
+	return summary
+}
+
+// matches returns whether the given rule values match the given value, including by wildcard
+func matches(values []string, value string) bool {
+	return contains(values, value) || contains(values, "*")
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
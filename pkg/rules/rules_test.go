@@ -0,0 +1,206 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rules
+
+import (
+	"reflect"
+	"testing"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+func TestAnalyze(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []rbacv1.PolicyRule
+		want  []Risk
+	}{
+		{
+			name:  "no rules",
+			rules: nil,
+			want:  []Risk{},
+		},
+		{
+			name:  "read-only pods",
+			rules: []rbacv1.PolicyRule{{Verbs: []string{"get", "list", "watch"}, APIGroups: []string{""}, Resources: []string{"pods", "pods/log"}}},
+			want:  []Risk{},
+		},
+		{
+			name:  "non-resource URLs are not analysed",
+			rules: []rbacv1.PolicyRule{{Verbs: []string{"*"}, NonResourceURLs: []string{"*"}}},
+			want:  []Risk{},
+		},
+		{
+			name:  "wildcard verbs",
+			rules: []rbacv1.PolicyRule{{Verbs: []string{"*"}, APIGroups: []string{"apps"}, Resources: []string{"deployments"}}},
+			want:  []Risk{WildcardVerbs},
+		},
+		{
+			name:  "wildcard resources",
+			rules: []rbacv1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{"apps"}, Resources: []string{"*"}}},
+			want:  []Risk{WildcardResources},
+		},
+		{
+			name:  "secrets",
+			rules: []rbacv1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"secrets"}}},
+			want:  []Risk{Secrets},
+		},
+		{
+			name:  "secrets in another API group",
+			rules: []rbacv1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{"example.com"}, Resources: []string{"secrets"}}},
+			want:  []Risk{},
+		},
+		{
+			name:  "escalate and bind on roles",
+			rules: []rbacv1.PolicyRule{{Verbs: []string{"escalate", "bind"}, APIGroups: []string{rbacv1.GroupName}, Resources: []string{"clusterroles"}}},
+			want:  []Risk{Escalate, Bind},
+		},
+		{
+			name:  "impersonate",
+			rules: []rbacv1.PolicyRule{{Verbs: []string{"impersonate"}, APIGroups: []string{""}, Resources: []string{"serviceaccounts"}}},
+			want:  []Risk{Impersonate},
+		},
+		{
+			name:  "exec",
+			rules: []rbacv1.PolicyRule{{Verbs: []string{"create"}, APIGroups: []string{""}, Resources: []string{"pods/exec"}}},
+			want:  []Risk{Exec},
+		},
+		{
+			name:  "nodes proxy",
+			rules: []rbacv1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"nodes/proxy"}}},
+			want:  []Risk{Nodes},
+		},
+		{
+			name:  "cluster admin",
+			rules: []rbacv1.PolicyRule{{Verbs: []string{"*"}, APIGroups: []string{"*"}, Resources: []string{"*"}}},
+			want:  []Risk{WildcardVerbs, WildcardResources, Secrets, Escalate, Bind, Impersonate, Exec, Nodes},
+		},
+		{
+			name: "one finding per risk in declaration order",
+			rules: []rbacv1.PolicyRule{
+				{Verbs: []string{"create"}, APIGroups: []string{""}, Resources: []string{"pods/attach"}},
+				{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"secrets"}},
+				{Verbs: []string{"list"}, APIGroups: []string{""}, Resources: []string{"secrets"}},
+			},
+			want: []Risk{Secrets, Exec},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []Risk{}
+			for _, finding := range Analyze(tt.rules) {
+				if finding.Message == "" {
+					t.Errorf("finding for risk %s has no message", finding.Risk)
+				}
+				got = append(got, finding.Risk)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Analyze(%v) risks = %v, want %v", tt.rules, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		name     string
+		findings []Finding
+		want     int
+	}{
+		{
+			name:     "no findings",
+			findings: nil,
+			want:     0,
+		},
+		{
+			name:     "single finding",
+			findings: []Finding{{Risk: Secrets}},
+			want:     20,
+		},
+		{
+			name:     "multiple findings",
+			findings: []Finding{{Risk: Secrets}, {Risk: Exec}},
+			want:     40,
+		},
+		{
+			name:     "repeated risk contributes once",
+			findings: []Finding{{Risk: Secrets}, {Risk: Secrets}},
+			want:     20,
+		},
+		{
+			name:     "score is capped",
+			findings: []Finding{{Risk: Impersonate}, {Risk: Escalate}, {Risk: Bind}},
+			want:     MaxScore,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Score(tt.findings); got != tt.want {
+				t.Errorf("Score(%v) = %d, want %d", tt.findings, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []rbacv1.PolicyRule
+		want  []string
+	}{
+		{
+			name:  "no rules",
+			rules: nil,
+			want:  []string{},
+		},
+		{
+			name:  "core resources",
+			rules: []rbacv1.PolicyRule{{Verbs: []string{"get", "list"}, APIGroups: []string{""}, Resources: []string{"pods", "pods/log"}}},
+			want:  []string{"get, list on pods, pods/log"},
+		},
+		{
+			name:  "resources qualified by API group",
+			rules: []rbacv1.PolicyRule{{Verbs: []string{"update"}, APIGroups: []string{"apps"}, Resources: []string{"deployments", "statefulsets"}}},
+			want:  []string{"update on deployments.apps, statefulsets.apps"},
+		},
+		{
+			name:  "resource names",
+			rules: []rbacv1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"configmaps"}, ResourceNames: []string{"settings", "features"}}},
+			want:  []string{"get on configmaps named settings, features"},
+		},
+		{
+			name:  "non-resource URLs",
+			rules: []rbacv1.PolicyRule{{Verbs: []string{"get"}, NonResourceURLs: []string{"/healthz", "/metrics"}}},
+			want:  []string{"get on /healthz, /metrics"},
+		},
+		{
+			name: "one description per rule",
+			rules: []rbacv1.PolicyRule{
+				{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods"}},
+				{Verbs: []string{"*"}, APIGroups: []string{"batch"}, Resources: []string{"jobs"}},
+			},
+			want: []string{"get on pods", "* on jobs.batch"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Summarize(tt.rules); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Summarize(%v) = %q, want %q", tt.rules, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	iamv1alpha1 "github.com/dippynark/access-request-controller/api/v1alpha1"
+	"github.com/go-logr/logr"
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// ApproverDelegationValidator ensures that approvers can only delegate their own approval rights
+// and only for a bounded time window
+type ApproverDelegationValidator struct {
+	Log logr.Logger
+	// MaxDuration, if set, limits how long a delegation may last
+	MaxDuration time.Duration
+
+	decoder *admission.Decoder
+}
+
+// Handle validates the approverdelegation in the admission request
+func (v *ApproverDelegationValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	log := v.Log.WithValues("approverdelegation", req.Name)
+
+	approverDelegation := &iamv1alpha1.ApproverDelegation{}
+	if err := v.decoder.Decode(req, approverDelegation); err != nil {
+		log.Error(err, "unable to decode ApproverDelegation")
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	// Delegations are revoked by deleting them so they cannot be changed
+	if req.Operation == admissionv1.Update {
+		oldApproverDelegation := &iamv1alpha1.ApproverDelegation{}
+		if err := v.decoder.DecodeRaw(req.OldObject, oldApproverDelegation); err != nil {
+			log.Error(err, "unable to decode old ApproverDelegation")
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if !equality.Semantic.DeepEqual(approverDelegation.Spec, oldApproverDelegation.Spec) {
+			return admission.Denied("spec of ApproverDelegation is immutable")
+		}
+		return admission.Allowed("")
+	}
+
+	spec := approverDelegation.Spec
+	if spec.Delegator != req.UserInfo.Username {
+		return admission.Denied(fmt.Sprintf("%s can only delegate their own approval rights so spec.delegator must be %s", req.UserInfo.Username, req.UserInfo.Username))
+	}
+	if spec.Delegate == "" || spec.Delegate == spec.Delegator {
+		return admission.Denied("spec.delegate must be set to another user")
+	}
+
+	start := time.Now()
+	if spec.StartTime != nil {
+		start = spec.StartTime.Time
+	}
+	if !spec.EndTime.After(start) {
+		return admission.Denied("spec.endTime must be after the start of the delegation")
+	}
+	if v.MaxDuration > 0 && spec.EndTime.Sub(start) > v.MaxDuration {
+		return admission.Denied(fmt.Sprintf("ApproverDelegation cannot last longer than %s", v.MaxDuration))
+	}
+
+	return admission.Allowed("")
+}
+
+// InjectDecoder injects the decoder used to decode approverdelegations
+func (v *ApproverDelegationValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
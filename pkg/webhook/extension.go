@@ -0,0 +1,133 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"fmt"
+
+	iamv1alpha1 "github.com/dippynark/access-request-controller/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// mutateExtensions records who requested each new extension of the accessrequest and records
+// approvals of existing extensions. Like the accessrequest, an extension remains unapproved until
+// it has enough approvals
+func (m *AccessRequestMutator) mutateExtensions(ctx context.Context, req admission.Request, accessRequest, oldAccessRequest *iamv1alpha1.AccessRequest) error {
+	for i := range accessRequest.Spec.Extensions {
+		extension := &accessRequest.Spec.Extensions[i]
+		if i >= len(oldAccessRequest.Spec.Extensions) {
+			// Requesting an extension does not approve it
+			extension.RequestedBy = req.UserInfo.Username
+			extension.Approved = false
+			extension.Approvals = nil
+			continue
+		}
+
+		// Approvals can only be added by the mutating webhook so any set by the user are replaced with
+		// those already recorded
+		oldExtension := &oldAccessRequest.Spec.Extensions[i]
+		extension.RequestedBy = oldExtension.RequestedBy
+		extension.Approvals = oldExtension.Approvals
+		if extension.Approved && !oldExtension.Approved {
+			approval, err := m.newApproval(ctx, req, accessRequest)
+			if err != nil {
+				return err
+			}
+			if !hasApproved(extension.Approvals, approval) {
+				extension.Approvals = append(extension.Approvals, approval)
+			}
+			extension.Approved = len(iamv1alpha1.ExtensionApprovals(extension)) >= iamv1alpha1.RequiredApprovals(accessRequest)
+		}
+	}
+	return nil
+}
+
+// validateExtensions verifies that extensions are only requested by the creator of a time-bound
+// accessrequest that is granting access, one at a time, and that the only change to an existing
+// extension is the requesting user approving it. It returns the approvals added to extensions
+func validateExtensions(req admission.Request, accessRequest, oldAccessRequest *iamv1alpha1.AccessRequest) ([]iamv1alpha1.Approval, error) {
+	extensions, oldExtensions := accessRequest.Spec.Extensions, oldAccessRequest.Spec.Extensions
+	if len(extensions) < len(oldExtensions) {
+		return nil, fmt.Errorf("spec.extensions of AccessRequest %s/%s cannot be removed", accessRequest.Namespace, accessRequest.Name)
+	}
+
+	approvals := []iamv1alpha1.Approval{}
+	for i := range oldExtensions {
+		extension, oldExtension := &extensions[i], &oldExtensions[i]
+		if extension.Reason != oldExtension.Reason || extension.Duration != oldExtension.Duration || extension.RequestedBy != oldExtension.RequestedBy {
+			return nil, fmt.Errorf("spec.extensions[%d].reason, duration and requestedBy of AccessRequest %s/%s are immutable", i, accessRequest.Namespace, accessRequest.Name)
+		}
+		if oldExtension.Approved && !extension.Approved {
+			return nil, fmt.Errorf("spec.extensions[%d] of AccessRequest %s/%s has been approved so approval cannot be withdrawn", i, accessRequest.Namespace, accessRequest.Name)
+		}
+		if equality.Semantic.DeepEqual(extension.Approvals, oldExtension.Approvals) {
+			continue
+		}
+		if len(extension.Approvals) != len(oldExtension.Approvals)+1 ||
+			!equality.Semantic.DeepEqual(extension.Approvals[:len(oldExtension.Approvals)], oldExtension.Approvals) ||
+			extension.Approvals[len(oldExtension.Approvals)].User != req.UserInfo.Username ||
+			!equality.Semantic.DeepEqual(extension.Approvals[len(oldExtension.Approvals)].UserInfo, iamv1alpha1.NewUserInfo(req.UserInfo)) {
+			return nil, fmt.Errorf("spec.extensions[%d].approvals of AccessRequest %s/%s can only be changed by approving the extension", i, accessRequest.Namespace, accessRequest.Name)
+		}
+		if extension.Approved && len(iamv1alpha1.ExtensionApprovals(extension)) < iamv1alpha1.RequiredApprovals(accessRequest) {
+			return nil, fmt.Errorf("spec.extensions[%d] of AccessRequest %s/%s requires %d approvals", i, accessRequest.Namespace, accessRequest.Name, iamv1alpha1.RequiredApprovals(accessRequest))
+		}
+		approvals = append(approvals, extension.Approvals[len(oldExtension.Approvals)])
+	}
+
+	if len(extensions) == len(oldExtensions) {
+		return approvals, nil
+	}
+	if len(extensions) > len(oldExtensions)+1 {
+		return nil, fmt.Errorf("only one extension of AccessRequest %s/%s can be requested at a time", accessRequest.Namespace, accessRequest.Name)
+	}
+	for i := range oldExtensions {
+		if !oldExtensions[i].Approved {
+			return nil, fmt.Errorf("spec.extensions[%d] of AccessRequest %s/%s must be approved before another extension is requested", i, accessRequest.Namespace, accessRequest.Name)
+		}
+	}
+	if !isGrantingTimeBoundAccess(oldAccessRequest) {
+		return nil, fmt.Errorf("AccessRequest %s/%s can only be extended while it is granting time-bound access", accessRequest.Namespace, accessRequest.Name)
+	}
+	if accessRequest.Spec.Attributes == nil || req.UserInfo.Username != accessRequest.Spec.Attributes.CreatedBy {
+		return nil, fmt.Errorf("AccessRequest %s/%s can only be extended by the user who created it", accessRequest.Namespace, accessRequest.Name)
+	}
+	extension := &extensions[len(extensions)-1]
+	if extension.Reason == "" {
+		return nil, fmt.Errorf("spec.extensions[%d].reason of AccessRequest %s/%s must be set", len(extensions)-1, accessRequest.Namespace, accessRequest.Name)
+	}
+	if extension.Duration.Duration <= 0 {
+		return nil, fmt.Errorf("spec.extensions[%d].duration of AccessRequest %s/%s must be positive", len(extensions)-1, accessRequest.Namespace, accessRequest.Name)
+	}
+	return approvals, nil
+}
+
+// isGrantingTimeBoundAccess returns whether the accessrequest is granting time-bound access
+func isGrantingTimeBoundAccess(accessRequest *iamv1alpha1.AccessRequest) bool {
+	if accessRequest.Status.ExpirationTime.IsZero() || isFinished(accessRequest) {
+		return false
+	}
+	for _, condition := range accessRequest.Status.Conditions {
+		if condition.Type == iamv1alpha1.AccessRequestComplete && condition.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,199 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	iamv1alpha1 "github.com/dippynark/access-request-controller/api/v1alpha1"
+	"github.com/dippynark/access-request-controller/pkg/delegation"
+	"github.com/go-logr/logr"
+	admissionv1 "k8s.io/api/admission/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// +kubebuilder:rbac:groups=iam.dippynark.co.uk,resources=accessrequesttemplates,verbs=get;list;watch
+
+// AccessRequestMutator records who created and approved accessrequests and expands the templates
+// they reference
+type AccessRequestMutator struct {
+	Client client.Client
+	Log    logr.Logger
+
+	decoder *admission.Decoder
+}
+
+// Handle expands the referenced template and sets the createdBy attributes on create, and records
+// approvals, setting the approvedBy attribute once the accessrequest has enough approvals, and
+// extensions
+func (m *AccessRequestMutator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	log := m.Log.WithValues("accessrequest", fmt.Sprintf("%s/%s", req.Namespace, req.Name))
+
+	if req.Resource != accessRequestResource {
+		err := fmt.Errorf("expect resource to be %s", accessRequestResource)
+		log.Error(err, "unexpected resource")
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	accessRequest := &iamv1alpha1.AccessRequest{}
+	if err := m.decoder.Decode(req, accessRequest); err != nil {
+		log.Error(err, "unable to decode AccessRequest")
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	oldAccessRequest := &iamv1alpha1.AccessRequest{}
+	if req.Operation == admissionv1.Update {
+		if err := m.decoder.DecodeRaw(req.OldObject, oldAccessRequest); err != nil {
+			log.Error(err, "unable to decode old AccessRequest")
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+	}
+
+	// Ensure attributes object
+	if accessRequest.Spec.Attributes == nil {
+		accessRequest.Spec.Attributes = &iamv1alpha1.Attributes{}
+	}
+
+	// Set createdBy attribute on create, along with the groups and other attributes of the user so
+	// that the controller can verify their access again
+	if req.Operation == admissionv1.Create {
+		accessRequest.Spec.Attributes.CreatedBy = req.UserInfo.Username
+		accessRequest.Spec.Attributes.CreatedByUserInfo = iamv1alpha1.NewUserInfo(req.UserInfo)
+	}
+
+	// Expand the referenced template on create
+	if req.Operation == admissionv1.Create && accessRequest.Spec.Template != nil {
+		template := &iamv1alpha1.AccessRequestTemplate{}
+		err := m.Client.Get(ctx, types.NamespacedName{Name: accessRequest.Spec.Template.Name}, template)
+		if k8serrors.IsNotFound(err) {
+			return admission.Denied(fmt.Sprintf("AccessRequestTemplate %s not found", accessRequest.Spec.Template.Name))
+		}
+		if err != nil {
+			log.Error(err, "unable to get AccessRequestTemplate")
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+		if err := expandTemplate(accessRequest, template); err != nil {
+			return admission.Denied(err.Error())
+		}
+	}
+
+	// Record approvals. Approvals can only be added by the mutating webhook so any set by the user
+	// are replaced with those already recorded
+	accessRequest.Spec.Attributes.Approvals = nil
+	if oldAccessRequest.Spec.Attributes != nil {
+		accessRequest.Spec.Attributes.Approvals = oldAccessRequest.Spec.Attributes.Approvals
+	}
+	switch {
+	case accessRequest.Spec.Approved && !oldAccessRequest.Spec.Approved:
+		approval, err := m.newApproval(ctx, req, accessRequest)
+		if err != nil {
+			log.Error(err, "unable to check approver access")
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+		if !hasApproved(accessRequest.Spec.Attributes.Approvals, approval) {
+			accessRequest.Spec.Attributes.Approvals = append(accessRequest.Spec.Attributes.Approvals, approval)
+		}
+		// The accessrequest remains unapproved until it has enough approvals
+		accessRequest.Spec.Approved = len(accessRequest.Spec.Attributes.Approvals) >= iamv1alpha1.RequiredApprovals(accessRequest)
+
+		// Set approvedBy attribute when approved. Other updates to an approved accessrequest, such as
+		// the controller adding a finalizer, must not change who approved it
+		if accessRequest.Spec.Approved {
+			accessRequest.Spec.Attributes.ApprovedBy = req.UserInfo.Username
+		}
+	case !accessRequest.Spec.Approved && oldAccessRequest.Spec.Approved:
+		// Withdrawing approval discards all approvals
+		accessRequest.Spec.Attributes.Approvals = nil
+	}
+
+	// Record who requested and approved extensions
+	if err := m.mutateExtensions(ctx, req, accessRequest, oldAccessRequest); err != nil {
+		log.Error(err, "unable to check approver access")
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	// Patches are computed by diffing the mutated accessrequest against the original so that
+	// values are always correctly encoded
+	marshaledAccessRequest, err := json.Marshal(accessRequest)
+	if err != nil {
+		log.Error(err, "unable to marshal AccessRequest")
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaledAccessRequest)
+}
+
+// newApproval returns the approval of the accessrequest by the requesting user. Users who are not
+// allowed to approve the accessrequest themselves approve it on behalf of an approver who has
+// delegated their approval rights to them, if there is one. The validating webhook verifies that
+// the approval is allowed
+func (m *AccessRequestMutator) newApproval(ctx context.Context, req admission.Request, accessRequest *iamv1alpha1.AccessRequest) (iamv1alpha1.Approval, error) {
+	approval := iamv1alpha1.Approval{
+		User:     req.UserInfo.Username,
+		UserInfo: iamv1alpha1.NewUserInfo(req.UserInfo),
+		Time:     metav1.Now(),
+	}
+
+	namespaces, err := accessNamespaces(ctx, m.Client, accessRequest)
+	if err != nil {
+		return approval, err
+	}
+	allowed, err := approverAllowedInNamespaces(ctx, m.Client, accessRequest, approval, namespaces)
+	if err != nil || allowed {
+		return approval, err
+	}
+
+	delegators, err := delegation.Delegators(ctx, m.Client, approval.User, approval.Time.Time)
+	if err != nil {
+		return approval, err
+	}
+	for _, delegator := range delegators {
+		delegatedApproval := approval
+		delegatedApproval.Delegator = delegator
+		allowed, err := approverAllowedInNamespaces(ctx, m.Client, accessRequest, delegatedApproval, namespaces)
+		if err != nil {
+			return approval, err
+		}
+		if allowed {
+			return delegatedApproval, nil
+		}
+	}
+	return approval, nil
+}
+
+// hasApproved returns whether the given approvals already include the user or the approver that
+// the approval counts for
+func hasApproved(approvals []iamv1alpha1.Approval, approval iamv1alpha1.Approval) bool {
+	for _, existing := range approvals {
+		if existing.User == approval.User || iamv1alpha1.Approver(existing) == iamv1alpha1.Approver(approval) {
+			return true
+		}
+	}
+	return false
+}
+
+// InjectDecoder injects the decoder used to decode accessrequests
+func (m *AccessRequestMutator) InjectDecoder(d *admission.Decoder) error {
+	m.decoder = d
+	return nil
+}
@@ -0,0 +1,206 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	iamv1alpha1 "github.com/dippynark/access-request-controller/api/v1alpha1"
+	"github.com/go-logr/logr"
+	admissionv1 "k8s.io/api/admission/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// systemUsernames are the users, in addition to the controller, that may delete rolebindings
+// controlled by accessrequests, or remove their owner references and finalizers, so that garbage
+// collection and namespace deletion are not blocked
+var systemUsernames = []string{
+	"system:serviceaccount:kube-system:generic-garbage-collector",
+	"system:serviceaccount:kube-system:namespace-controller",
+}
+
+// RoleBindingValidator protects rolebindings controlled by accessrequests from being changed by
+// anyone other than the controller
+type RoleBindingValidator struct {
+	Client client.Client
+	Log    logr.Logger
+	// ControllerUsername is the username of the controller's service account, for example
+	// system:serviceaccount:access-request-controller-system:default
+	ControllerUsername string
+
+	decoder *admission.Decoder
+}
+
+// Handle validates the rolebinding in the admission request
+func (v *RoleBindingValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	log := v.Log.WithValues("rolebinding", fmt.Sprintf("%s/%s", req.Namespace, req.Name))
+
+	roleBinding := &rbacv1.RoleBinding{}
+	switch req.Operation {
+	case admissionv1.Create:
+		if err := v.decoder.Decode(req, roleBinding); err != nil {
+			log.Error(err, "unable to decode RoleBinding")
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		return v.validateCreate(ctx, log, req, roleBinding)
+	case admissionv1.Update, admissionv1.Delete:
+		// Whether the rolebinding is controlled by an accessrequest is decided by the old object so
+		// that the controller reference cannot be removed to bypass validation
+		if err := v.decoder.DecodeRaw(req.OldObject, roleBinding); err != nil {
+			log.Error(err, "unable to decode RoleBinding")
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		accessRequest := controllingAccessRequest(roleBinding)
+		if accessRequest == "" || v.allowed(req.UserInfo.Username, req.Operation) {
+			return admission.Allowed("")
+		}
+		if req.Operation == admissionv1.Update && isSystemUsername(req.UserInfo.Username) {
+			newRoleBinding := &rbacv1.RoleBinding{}
+			if err := v.decoder.Decode(req, newRoleBinding); err != nil {
+				log.Error(err, "unable to decode RoleBinding")
+				return admission.Errored(http.StatusBadRequest, err)
+			}
+			if onlyOwnershipChanged(roleBinding, newRoleBinding) {
+				return admission.Allowed("")
+			}
+		}
+		return admission.Denied(fmt.Sprintf("RoleBinding %s/%s is controlled by AccessRequest %s and can only be changed by the access-request-controller", roleBinding.Namespace, roleBinding.Name, accessRequest))
+	}
+
+	return admission.Allowed("")
+}
+
+// InjectDecoder injects the decoder used to decode rolebindings
+func (v *RoleBindingValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+// validateCreate denies creating a rolebinding that would prevent a pending accessrequest from
+// being granted
+func (v *RoleBindingValidator) validateCreate(ctx context.Context, log logr.Logger, req admission.Request, roleBinding *rbacv1.RoleBinding) admission.Response {
+	// Rolebindings in other namespaces than their accessrequest are identified by their label so
+	// only the controller may set it
+	uid := roleBinding.Labels[iamv1alpha1.AccessRequestUIDLabel]
+	if uid != "" && req.UserInfo.Username != v.ControllerUsername {
+		return admission.Denied(fmt.Sprintf("RoleBinding %s/%s sets label %s which can only be set by the access-request-controller", req.Namespace, roleBinding.Name, iamv1alpha1.AccessRequestUIDLabel))
+	}
+
+	// Accessrequests in any namespace may grant access in this one
+	accessRequestList := &iamv1alpha1.AccessRequestList{}
+	if err := v.Client.List(ctx, accessRequestList); err != nil {
+		log.Error(err, "unable to list AccessRequests")
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	for i := range accessRequestList.Items {
+		accessRequest := &accessRequestList.Items[i]
+		if !reservesRoleBindingName(accessRequest, req.Namespace, roleBinding.Name) {
+			continue
+		}
+
+		// The controller creates the rolebinding for the accessrequest
+		ref := accessRequestControllerOf(roleBinding)
+		if ((ref != nil && ref.UID == accessRequest.UID) || uid == string(accessRequest.UID)) && v.allowed(req.UserInfo.Username, req.Operation) {
+			return admission.Allowed("")
+		}
+
+		if isPending(accessRequest) {
+			return admission.Denied(fmt.Sprintf("RoleBinding %s/%s collides with pending AccessRequest %s/%s", req.Namespace, roleBinding.Name, accessRequest.Namespace, accessRequest.Name))
+		}
+	}
+
+	return admission.Allowed("")
+}
+
+// reservesRoleBindingName returns whether the accessrequest creates a rolebinding with the given
+// name in the given namespace
+func reservesRoleBindingName(accessRequest *iamv1alpha1.AccessRequest, namespace, name string) bool {
+	for _, roleRef := range iamv1alpha1.RoleRefs(accessRequest) {
+		if iamv1alpha1.RoleBindingName(accessRequest, namespace, roleRef) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// allowed returns whether the given user may perform the given operation on rolebindings
+// controlled by accessrequests
+func (v *RoleBindingValidator) allowed(username string, operation admissionv1.Operation) bool {
+	if username == v.ControllerUsername {
+		return true
+	}
+	return operation == admissionv1.Delete && isSystemUsername(username)
+}
+
+// isSystemUsername returns whether the given user is one of the system users that clean up
+// rolebindings
+func isSystemUsername(username string) bool {
+	for _, systemUsername := range systemUsernames {
+		if username == systemUsername {
+			return true
+		}
+	}
+	return false
+}
+
+// onlyOwnershipChanged returns whether the only changes to the rolebinding are to its owner
+// references, finalizers or other metadata that does not grant access or associate it with an
+// accessrequest, as made by the garbage collector when orphaning it
+func onlyOwnershipChanged(oldRoleBinding, roleBinding *rbacv1.RoleBinding) bool {
+	return equality.Semantic.DeepEqual(oldRoleBinding.Subjects, roleBinding.Subjects) &&
+		equality.Semantic.DeepEqual(oldRoleBinding.RoleRef, roleBinding.RoleRef) &&
+		equality.Semantic.DeepEqual(oldRoleBinding.Labels, roleBinding.Labels) &&
+		equality.Semantic.DeepEqual(oldRoleBinding.Annotations, roleBinding.Annotations)
+}
+
+// accessRequestControllerOf returns the controller reference of the rolebinding if it is controlled
+// by an accessrequest
+func accessRequestControllerOf(roleBinding *rbacv1.RoleBinding) *metav1.OwnerReference {
+	ref := metav1.GetControllerOf(roleBinding)
+	if ref == nil || ref.Kind != "AccessRequest" {
+		return nil
+	}
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	if err != nil || gv.Group != iamv1alpha1.GroupVersion.Group {
+		return nil
+	}
+	return ref
+}
+
+// controllingAccessRequest returns the accessrequest controlling the rolebinding, either through its
+// controller reference or, for rolebindings in other namespaces, its label, or an empty string if it
+// is not controlled by an accessrequest
+func controllingAccessRequest(roleBinding *rbacv1.RoleBinding) string {
+	if ref := accessRequestControllerOf(roleBinding); ref != nil {
+		return ref.Name
+	}
+	if roleBinding.Labels[iamv1alpha1.AccessRequestUIDLabel] == "" {
+		return ""
+	}
+	if accessRequest := roleBinding.Annotations[iamv1alpha1.AccessRequestAnnotation]; accessRequest != "" {
+		return accessRequest
+	}
+	return roleBinding.Labels[iamv1alpha1.AccessRequestUIDLabel]
+}
@@ -0,0 +1,106 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	iamv1alpha1 "github.com/dippynark/access-request-controller/api/v1alpha1"
+)
+
+// expandTemplate sets the roles, rules, namespaces, duration and required approvals of the
+// accessrequest from the given template, substituting the parameters of the accessrequest
+func expandTemplate(accessRequest *iamv1alpha1.AccessRequest, template *iamv1alpha1.AccessRequestTemplate) error {
+	spec := &accessRequest.Spec
+	if spec.RoleRef.Name != "" || len(spec.RoleRefs) > 0 || len(spec.Rules) > 0 ||
+		len(spec.Namespaces) > 0 || spec.NamespaceSelector != nil || spec.RequiredApprovals != nil {
+		return fmt.Errorf("spec.roleRef, spec.roleRefs, spec.rules, spec.namespaces, spec.namespaceSelector and spec.requiredApprovals are set by AccessRequestTemplate %s", template.Name)
+	}
+
+	replacer, err := templateReplacer(template, spec.Template.Parameters)
+	if err != nil {
+		return err
+	}
+
+	for _, roleRef := range template.Spec.RoleRefs {
+		roleRef.Name = replacer.Replace(roleRef.Name)
+		spec.RoleRefs = append(spec.RoleRefs, roleRef)
+	}
+	for _, rule := range template.Spec.Rules {
+		rule = *rule.DeepCopy()
+		for i := range rule.ResourceNames {
+			rule.ResourceNames[i] = replacer.Replace(rule.ResourceNames[i])
+		}
+		spec.Rules = append(spec.Rules, rule)
+	}
+	for _, namespace := range template.Spec.Namespaces {
+		// Optional parameters without a default expand to nothing
+		if namespace = replacer.Replace(namespace); namespace != "" {
+			spec.Namespaces = append(spec.Namespaces, namespace)
+		}
+	}
+	if template.Spec.NamespaceSelector != nil {
+		spec.NamespaceSelector = template.Spec.NamespaceSelector.DeepCopy()
+		for key, value := range spec.NamespaceSelector.MatchLabels {
+			spec.NamespaceSelector.MatchLabels[key] = replacer.Replace(value)
+		}
+	}
+	if spec.Duration == nil && template.Spec.Duration != nil {
+		spec.Duration = template.Spec.Duration.DeepCopy()
+	}
+	if template.Spec.RequiredApprovals != nil {
+		requiredApprovals := *template.Spec.RequiredApprovals
+		spec.RequiredApprovals = &requiredApprovals
+	}
+
+	return nil
+}
+
+// templateReplacer returns a replacer that substitutes the parameters of the template with the
+// given values or their defaults
+func templateReplacer(template *iamv1alpha1.AccessRequestTemplate, values map[string]string) (*strings.Replacer, error) {
+	parameters := map[string]iamv1alpha1.TemplateParameter{}
+	for _, parameter := range template.Spec.Parameters {
+		parameters[parameter.Name] = parameter
+	}
+
+	unknown := []string{}
+	for name := range values {
+		if _, ok := parameters[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("AccessRequestTemplate %s does not define parameters %s", template.Name, strings.Join(unknown, ", "))
+	}
+
+	oldnew := []string{}
+	for _, parameter := range template.Spec.Parameters {
+		value, ok := values[parameter.Name]
+		if parameter.Required && value == "" {
+			return nil, fmt.Errorf("AccessRequestTemplate %s requires parameter %s", template.Name, parameter.Name)
+		}
+		if !ok {
+			value = parameter.Default
+		}
+		oldnew = append(oldnew, fmt.Sprintf("$(%s)", parameter.Name), value)
+	}
+	return strings.NewReplacer(oldnew...), nil
+}
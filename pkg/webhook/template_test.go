@@ -0,0 +1,265 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	iamv1alpha1 "github.com/dippynark/access-request-controller/api/v1alpha1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestTemplateReplacer(t *testing.T) {
+	template := &iamv1alpha1.AccessRequestTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "debug"},
+		Spec: iamv1alpha1.AccessRequestTemplateSpec{
+			Parameters: []iamv1alpha1.TemplateParameter{
+				{Name: "app", Required: true},
+				{Name: "environment", Default: "staging"},
+				{Name: "namespace"},
+			},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		values  map[string]string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "required parameter",
+			values: map[string]string{"app": "checkout"},
+			input:  "$(app)-debug",
+			want:   "checkout-debug",
+		},
+		{
+			name:   "default value",
+			values: map[string]string{"app": "checkout"},
+			input:  "$(app)-$(environment)",
+			want:   "checkout-staging",
+		},
+		{
+			name:   "value overrides default",
+			values: map[string]string{"app": "checkout", "environment": "production"},
+			input:  "$(app)-$(environment)",
+			want:   "checkout-production",
+		},
+		{
+			name:   "optional parameter without default",
+			values: map[string]string{"app": "checkout"},
+			input:  "$(namespace)",
+			want:   "",
+		},
+		{
+			name:   "repeated parameter",
+			values: map[string]string{"app": "checkout"},
+			input:  "$(app)/$(app)",
+			want:   "checkout/checkout",
+		},
+		{
+			name:   "undefined parameter reference is left unchanged",
+			values: map[string]string{"app": "checkout"},
+			input:  "$(team)",
+			want:   "$(team)",
+		},
+		{
+			name:   "values are not substituted again",
+			values: map[string]string{"app": "$(environment)"},
+			input:  "$(app)",
+			want:   "$(environment)",
+		},
+		{
+			name:    "missing required parameter",
+			values:  map[string]string{"environment": "production"},
+			wantErr: true,
+		},
+		{
+			name:    "empty required parameter",
+			values:  map[string]string{"app": ""},
+			wantErr: true,
+		},
+		{
+			name:    "unknown parameter",
+			values:  map[string]string{"app": "checkout", "team": "payments"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replacer, err := templateReplacer(template, tt.values)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("templateReplacer(%v) error = %v, wantErr %v", tt.values, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := replacer.Replace(tt.input); got != tt.want {
+				t.Errorf("Replace(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandTemplate(t *testing.T) {
+	hour := &metav1.Duration{Duration: time.Hour}
+	twoApprovals := int32(2)
+	template := &iamv1alpha1.AccessRequestTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "debug"},
+		Spec: iamv1alpha1.AccessRequestTemplateSpec{
+			RoleRefs: []rbacv1.RoleRef{
+				{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: "$(app)-debug"},
+			},
+			Rules: []rbacv1.PolicyRule{
+				{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"configmaps"}, ResourceNames: []string{"$(app)-config"}},
+			},
+			Namespaces:        []string{"$(app)", "$(extra)"},
+			Duration:          hour,
+			RequiredApprovals: &twoApprovals,
+			Parameters: []iamv1alpha1.TemplateParameter{
+				{Name: "app", Required: true},
+				{Name: "extra"},
+			},
+		},
+	}
+	selectorTemplate := &iamv1alpha1.AccessRequestTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "team"},
+		Spec: iamv1alpha1.AccessRequestTemplateSpec{
+			RoleRefs: []rbacv1.RoleRef{
+				{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: "view"},
+			},
+			NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "$(team)"}},
+			Parameters: []iamv1alpha1.TemplateParameter{
+				{Name: "team", Default: "platform"},
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		template *iamv1alpha1.AccessRequestTemplate
+		spec     iamv1alpha1.AccessRequestSpec
+		want     iamv1alpha1.AccessRequestSpec
+		wantErr  bool
+	}{
+		{
+			name:     "parameters are substituted",
+			template: template,
+			spec: iamv1alpha1.AccessRequestSpec{
+				Template: &iamv1alpha1.TemplateReference{Name: "debug", Parameters: map[string]string{"app": "checkout"}},
+			},
+			want: iamv1alpha1.AccessRequestSpec{
+				Template: &iamv1alpha1.TemplateReference{Name: "debug", Parameters: map[string]string{"app": "checkout"}},
+				RoleRefs: []rbacv1.RoleRef{
+					{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: "checkout-debug"},
+				},
+				Rules: []rbacv1.PolicyRule{
+					{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"configmaps"}, ResourceNames: []string{"checkout-config"}},
+				},
+				Namespaces:        []string{"checkout"},
+				Duration:          hour,
+				RequiredApprovals: &twoApprovals,
+			},
+		},
+		{
+			name:     "requested duration is kept",
+			template: template,
+			spec: iamv1alpha1.AccessRequestSpec{
+				Template: &iamv1alpha1.TemplateReference{Name: "debug", Parameters: map[string]string{"app": "checkout", "extra": "shared"}},
+				Duration: &metav1.Duration{Duration: 30 * time.Minute},
+			},
+			want: iamv1alpha1.AccessRequestSpec{
+				Template: &iamv1alpha1.TemplateReference{Name: "debug", Parameters: map[string]string{"app": "checkout", "extra": "shared"}},
+				RoleRefs: []rbacv1.RoleRef{
+					{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: "checkout-debug"},
+				},
+				Rules: []rbacv1.PolicyRule{
+					{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"configmaps"}, ResourceNames: []string{"checkout-config"}},
+				},
+				Namespaces:        []string{"checkout", "shared"},
+				Duration:          &metav1.Duration{Duration: 30 * time.Minute},
+				RequiredApprovals: &twoApprovals,
+			},
+		},
+		{
+			name:     "namespace selector labels are substituted",
+			template: selectorTemplate,
+			spec: iamv1alpha1.AccessRequestSpec{
+				Template: &iamv1alpha1.TemplateReference{Name: "team"},
+			},
+			want: iamv1alpha1.AccessRequestSpec{
+				Template: &iamv1alpha1.TemplateReference{Name: "team"},
+				RoleRefs: []rbacv1.RoleRef{
+					{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: "view"},
+				},
+				NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "platform"}},
+			},
+		},
+		{
+			name:     "missing required parameter",
+			template: template,
+			spec: iamv1alpha1.AccessRequestSpec{
+				Template: &iamv1alpha1.TemplateReference{Name: "debug"},
+			},
+			wantErr: true,
+		},
+		{
+			name:     "unknown parameter",
+			template: template,
+			spec: iamv1alpha1.AccessRequestSpec{
+				Template: &iamv1alpha1.TemplateReference{Name: "debug", Parameters: map[string]string{"app": "checkout", "team": "payments"}},
+			},
+			wantErr: true,
+		},
+		{
+			name:     "roles set by the template",
+			template: template,
+			spec: iamv1alpha1.AccessRequestSpec{
+				Template: &iamv1alpha1.TemplateReference{Name: "debug", Parameters: map[string]string{"app": "checkout"}},
+				RoleRef:  rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: "admin"},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			accessRequest := &iamv1alpha1.AccessRequest{Spec: tt.spec}
+			err := expandTemplate(accessRequest, tt.template)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expandTemplate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(accessRequest.Spec, tt.want) {
+				t.Errorf("expandTemplate() spec = %+v, want %+v", accessRequest.Spec, tt.want)
+			}
+		})
+	}
+
+	// The template must not be modified by expansion
+	if got := template.Spec.Rules[0].ResourceNames[0]; got != "$(app)-config" {
+		t.Errorf("template rule resource name = %q, want $(app)-config", got)
+	}
+	if got := selectorTemplate.Spec.NamespaceSelector.MatchLabels["team"]; got != "$(team)" {
+		t.Errorf("template namespace selector label = %q, want $(team)", got)
+	}
+}
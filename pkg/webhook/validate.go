@@ -0,0 +1,570 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	iamv1alpha1 "github.com/dippynark/access-request-controller/api/v1alpha1"
+	"github.com/dippynark/access-request-controller/pkg/delegation"
+	"github.com/dippynark/access-request-controller/pkg/rules"
+	"github.com/go-logr/logr"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// +kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=roles;clusterroles,verbs=get;list;watch
+
+// AccessRequestValidator validates changes to accessrequests and records their deletion
+type AccessRequestValidator struct {
+	Client client.Client
+	Log    logr.Logger
+	// TicketPattern, if set, is the pattern that accessrequest tickets must match
+	TicketPattern *regexp.Regexp
+
+	decoder *admission.Decoder
+}
+
+// Handle validates the accessrequest in the admission request
+func (v *AccessRequestValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	log := v.Log.WithValues("accessrequest", fmt.Sprintf("%s/%s", req.Namespace, req.Name))
+
+	if req.Resource != accessRequestResource {
+		err := fmt.Errorf("expect resource to be %s", accessRequestResource)
+		log.Error(err, "unexpected resource")
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	// The object being deleted is only available as the old object
+	if req.Operation == admissionv1.Delete {
+		return v.validateDeletion(ctx, log, req)
+	}
+
+	accessRequest := &iamv1alpha1.AccessRequest{}
+	if err := v.decoder.Decode(req, accessRequest); err != nil {
+		log.Error(err, "unable to decode AccessRequest")
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	oldAccessRequest := &iamv1alpha1.AccessRequest{}
+	if req.Operation == admissionv1.Update {
+		if err := v.decoder.DecodeRaw(req.OldObject, oldAccessRequest); err != nil {
+			log.Error(err, "unable to decode old AccessRequest")
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+	}
+
+	response := v.validate(ctx, log, req, accessRequest, oldAccessRequest)
+
+	// Warn about risky roles when an accessrequest is created or approved so that the requester and
+	// approver are aware of the privileges being granted
+	findings := []roleFinding{}
+	if req.Operation == admissionv1.Create || (accessRequest.Spec.Approved && !oldAccessRequest.Spec.Approved) {
+		findings = v.analyzeRoleRefs(ctx, log, accessRequest)
+		for _, finding := range findings {
+			response.Warnings = append(response.Warnings, fmt.Sprintf("%s %s", describeRoleRef(accessRequest, finding.roleRef), finding.Message))
+		}
+	}
+	response.AuditAnnotations = auditAnnotations(req, accessRequest, findings)
+
+	return response
+}
+
+// validate validates a created or updated accessrequest
+func (v *AccessRequestValidator) validate(ctx context.Context, log logr.Logger, req admission.Request, accessRequest, oldAccessRequest *iamv1alpha1.AccessRequest) admission.Response {
+	// Ensure createdBy attributes are immutable
+	if req.Operation == admissionv1.Update {
+		if accessRequest.Spec.Attributes == nil ||
+			oldAccessRequest.Spec.Attributes == nil ||
+			(accessRequest.Spec.Attributes.CreatedBy != oldAccessRequest.Spec.Attributes.CreatedBy) {
+			return admission.Denied("spec.attributes.createdBy is immutable")
+		}
+		if !equality.Semantic.DeepEqual(accessRequest.Spec.Attributes.CreatedByUserInfo, oldAccessRequest.Spec.Attributes.CreatedByUserInfo) {
+			return admission.Denied("spec.attributes.createdByUserInfo is immutable")
+		}
+	}
+
+	// Ensure approvedBy attribute is immutable while approved. The mutating webhook only sets it when
+	// the accessrequest is approved
+	if req.Operation == admissionv1.Update && accessRequest.Spec.Approved && oldAccessRequest.Spec.Approved {
+		if accessRequest.Spec.Attributes.ApprovedBy != oldAccessRequest.Spec.Attributes.ApprovedBy {
+			return admission.Denied("spec.attributes.approvedBy is immutable while approved")
+		}
+	}
+
+	// Ensure breakGlass and request metadata are immutable
+	if req.Operation == admissionv1.Update {
+		if !equality.Semantic.DeepEqual(accessRequest.Spec.BreakGlass, oldAccessRequest.Spec.BreakGlass) {
+			return admission.Denied("spec.breakGlass is immutable")
+		}
+		if accessRequest.Spec.Reason != oldAccessRequest.Spec.Reason ||
+			accessRequest.Spec.Ticket != oldAccessRequest.Spec.Ticket ||
+			!equality.Semantic.DeepEqual(accessRequest.Spec.Context, oldAccessRequest.Spec.Context) {
+			return admission.Denied("spec.reason, spec.ticket and spec.context are immutable")
+		}
+		// Approval applies to the referenced roles so they cannot be changed
+		if !equality.Semantic.DeepEqual(accessRequest.Spec.RoleRef, oldAccessRequest.Spec.RoleRef) ||
+			!equality.Semantic.DeepEqual(accessRequest.Spec.RoleRefs, oldAccessRequest.Spec.RoleRefs) {
+			return admission.Denied("spec.roleRef and spec.roleRefs are immutable")
+		}
+		// Approval applies to the subjects being granted access so they cannot be changed either
+		if !equality.Semantic.DeepEqual(accessRequest.Spec.Subjects, oldAccessRequest.Spec.Subjects) {
+			return admission.Denied("spec.subjects is immutable")
+		}
+		if !equality.Semantic.DeepEqual(accessRequest.Spec.Rules, oldAccessRequest.Spec.Rules) {
+			return admission.Denied("spec.rules is immutable")
+		}
+		if !equality.Semantic.DeepEqual(accessRequest.Spec.Template, oldAccessRequest.Spec.Template) ||
+			!equality.Semantic.DeepEqual(accessRequest.Spec.RequiredApprovals, oldAccessRequest.Spec.RequiredApprovals) {
+			return admission.Denied("spec.template and spec.requiredApprovals are immutable")
+		}
+		if !equality.Semantic.DeepEqual(accessRequest.Spec.StartTime, oldAccessRequest.Spec.StartTime) {
+			return admission.Denied("spec.startTime is immutable")
+		}
+		// Access can only be granted for longer through approved extensions
+		if !equality.Semantic.DeepEqual(accessRequest.Spec.Duration, oldAccessRequest.Spec.Duration) {
+			return admission.Denied("spec.duration is immutable; request more time through spec.extensions")
+		}
+		// Approval applies to the selected namespaces so they cannot be changed either
+		if !equality.Semantic.DeepEqual(accessRequest.Spec.Namespaces, oldAccessRequest.Spec.Namespaces) ||
+			!equality.Semantic.DeepEqual(accessRequest.Spec.NamespaceSelector, oldAccessRequest.Spec.NamespaceSelector) {
+			return admission.Denied("spec.namespaces and spec.namespaceSelector are immutable")
+		}
+	}
+
+	// Validate roles
+	if req.Operation == admissionv1.Create && len(iamv1alpha1.RoleRefs(accessRequest)) == 0 {
+		return admission.Denied(fmt.Sprintf("AccessRequest %s/%s must set spec.roleRef, spec.roleRefs or spec.rules", accessRequest.Namespace, accessRequest.Name))
+	}
+	if req.Operation == admissionv1.Create {
+		if err := validateRules(accessRequest.Spec.Rules); err != nil {
+			return admission.Denied(fmt.Sprintf("AccessRequest %s/%s has invalid spec.rules: %v", accessRequest.Namespace, accessRequest.Name, err))
+		}
+	}
+
+	// Validate durations against the maximum durations of the referenced roles
+	if req.Operation == admissionv1.Create {
+		response := v.validateMaxDuration(ctx, log, accessRequest)
+		if !response.Allowed {
+			return response
+		}
+	}
+
+	// Validate namespace selector
+	if req.Operation == admissionv1.Create && accessRequest.Spec.NamespaceSelector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(accessRequest.Spec.NamespaceSelector); err != nil {
+			return admission.Denied(fmt.Sprintf("AccessRequest %s/%s has an invalid spec.namespaceSelector: %v", accessRequest.Namespace, accessRequest.Name, err))
+		}
+	}
+
+	// Validate approvals
+	approvalsChanged := !equality.Semantic.DeepEqual(approvals(accessRequest), approvals(oldAccessRequest))
+	if approvalsChanged {
+		if err := validateApprovals(req, accessRequest, oldAccessRequest); err != nil {
+			return admission.Denied(err.Error())
+		}
+	}
+
+	// Withdrawing approval does not revoke access that has already been granted but would allow the
+	// accessrequest to be deleted without being allowed to revoke it, so it requires the same
+	// permissions as revoking or approving it
+	if req.Operation == admissionv1.Update && oldAccessRequest.Spec.Approved && !accessRequest.Spec.Approved && isActive(oldAccessRequest) {
+		allowed, err := v.withdrawalAllowed(ctx, req, accessRequest)
+		if err != nil {
+			log.Error(err, "unable to check revoke access")
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+		if !allowed {
+			return admission.Denied(fmt.Sprintf("%s is not allowed to withdraw approval of active AccessRequest %s/%s", req.UserInfo.Username, accessRequest.Namespace, accessRequest.Name))
+		}
+	}
+
+	// Validate extensions
+	extensionApprovals, err := validateExtensions(req, accessRequest, oldAccessRequest)
+	if err != nil {
+		return admission.Denied(err.Error())
+	}
+	if len(accessRequest.Spec.Extensions) > len(oldAccessRequest.Spec.Extensions) {
+		response := v.validateMaxDuration(ctx, log, accessRequest)
+		if !response.Allowed {
+			return response
+		}
+	}
+
+	// Accessrequests that have finished, for example because they were not approved in time, cannot
+	// be approved
+	if req.Operation == admissionv1.Update && len(approvals(accessRequest)) > len(approvals(oldAccessRequest)) && isFinished(oldAccessRequest) {
+		return admission.Denied(fmt.Sprintf("AccessRequest %s/%s has finished and cannot be approved", accessRequest.Namespace, accessRequest.Name))
+	}
+
+	// Break-glass requesters and approvers must be allowed in every namespace access is granted in
+	var namespaces []string
+	if (req.Operation == admissionv1.Create && accessRequest.Spec.BreakGlass != nil) || accessRequest.Spec.Approved || approvalsChanged || len(extensionApprovals) > 0 {
+		var err error
+		namespaces, err = accessNamespaces(ctx, v.Client, accessRequest)
+		if err != nil {
+			log.Error(err, "unable to get namespaces")
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+	}
+
+	// Validate request metadata
+	if req.Operation == admissionv1.Create {
+		if err := v.validateRequestMetadata(accessRequest); err != nil {
+			return admission.Denied(err.Error())
+		}
+	}
+
+	// Validate break-glass requester
+	if req.Operation == admissionv1.Create && accessRequest.Spec.BreakGlass != nil {
+		if accessRequest.Spec.BreakGlass.Justification == "" {
+			return admission.Denied(fmt.Sprintf("AccessRequest %s/%s is a break-glass request but spec.breakGlass.justification is not set", accessRequest.Namespace, accessRequest.Name))
+		}
+		if accessRequest.Spec.StartTime != nil {
+			return admission.Denied(fmt.Sprintf("AccessRequest %s/%s is a break-glass request so cannot set spec.startTime", accessRequest.Namespace, accessRequest.Name))
+		}
+
+		for _, namespace := range namespaces {
+			sar, err := checkUserAccess(ctx, v.Client, req.UserInfo, breakGlassVerb, accessRequest, namespace)
+			if err != nil {
+				log.Error(err, "unable to check break-glass access")
+				return admission.Errored(http.StatusInternalServerError, err)
+			}
+
+			if !sar.Status.Allowed || sar.Status.Denied {
+				return admission.Denied(fmt.Sprintf("%s is not allowed to create break-glass AccessRequest %s/%s in namespace %s", req.UserInfo.Username, accessRequest.Namespace, accessRequest.Name, namespace))
+			}
+		}
+	}
+
+	// Validate approvers
+	if accessRequest.Spec.Approved {
+		if accessRequest.Spec.Attributes == nil || accessRequest.Spec.Attributes.ApprovedBy == "" {
+			return admission.Denied(fmt.Sprintf("AccessRequest %s/%s has been approved but the approvedBy attribute is not set", accessRequest.Namespace, accessRequest.Name))
+		}
+		if !oldAccessRequest.Spec.Approved && len(iamv1alpha1.Approvals(accessRequest)) < iamv1alpha1.RequiredApprovals(accessRequest) {
+			return admission.Denied(fmt.Sprintf("AccessRequest %s/%s requires %d approvals", accessRequest.Namespace, accessRequest.Name, iamv1alpha1.RequiredApprovals(accessRequest)))
+		}
+	}
+	if accessRequest.Spec.BreakGlass != nil && approvalsChanged {
+		for _, approval := range iamv1alpha1.Approvals(accessRequest) {
+			if iamv1alpha1.ApprovedByRequester(accessRequest, approval) {
+				return admission.Denied(fmt.Sprintf("break-glass AccessRequest %s/%s must be reviewed by someone other than its requester", accessRequest.Namespace, accessRequest.Name))
+			}
+		}
+	}
+	if accessRequest.Spec.Approved || approvalsChanged {
+		for _, approval := range iamv1alpha1.Approvals(accessRequest) {
+			for _, namespace := range namespaces {
+				allowed, err := approverAllowed(ctx, v.Client, accessRequest, approval, namespace)
+				if err != nil {
+					log.Error(err, "unable to check approver access")
+					return admission.Errored(http.StatusInternalServerError, err)
+				}
+
+				if !allowed {
+					return admission.Denied(fmt.Sprintf("%s is not allowed to approve AccessRequest %s/%s in namespace %s", delegation.Describe(approval), accessRequest.Namespace, accessRequest.Name, namespace))
+				}
+			}
+		}
+	}
+
+	// Extensions must be approved under the same rules as the accessrequest
+	for _, approval := range extensionApprovals {
+		for _, namespace := range namespaces {
+			allowed, err := approverAllowed(ctx, v.Client, accessRequest, approval, namespace)
+			if err != nil {
+				log.Error(err, "unable to check approver access")
+				return admission.Errored(http.StatusInternalServerError, err)
+			}
+
+			if !allowed {
+				return admission.Denied(fmt.Sprintf("%s is not allowed to approve extensions of AccessRequest %s/%s in namespace %s", delegation.Describe(approval), accessRequest.Namespace, accessRequest.Name, namespace))
+			}
+		}
+	}
+
+	return admission.Allowed("")
+}
+
+// validateMaxDuration verifies that the accessrequest, including its extensions, does not request
+// access for longer than any of the roles it references allow
+func (v *AccessRequestValidator) validateMaxDuration(ctx context.Context, log logr.Logger, accessRequest *iamv1alpha1.AccessRequest) admission.Response {
+	for _, roleRef := range iamv1alpha1.RoleRefs(accessRequest) {
+		if roleRef == iamv1alpha1.InlineRoleRef(accessRequest) {
+			continue
+		}
+		objectMeta, _, err := getRole(ctx, v.Client, accessRequest.Namespace, roleRef)
+		if k8serrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			log.Error(err, "unable to get role", "kind", roleRef.Kind, "name", roleRef.Name)
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+
+		value, ok := objectMeta.Annotations[iamv1alpha1.MaxDurationAnnotation]
+		if !ok {
+			continue
+		}
+		maxDuration, err := time.ParseDuration(value)
+		if err != nil {
+			log.Error(err, "invalid maximum duration", "kind", roleRef.Kind, "name", roleRef.Name)
+			continue
+		}
+		if accessRequest.Spec.Duration == nil || accessRequest.Spec.Duration.Duration > maxDuration {
+			return admission.Denied(fmt.Sprintf("AccessRequest %s/%s must set spec.duration no longer than %s, the maximum duration of %s %s", accessRequest.Namespace, accessRequest.Name, maxDuration, roleRef.Kind, roleRef.Name))
+		}
+		duration := accessRequest.Spec.Duration.Duration
+		for _, extension := range accessRequest.Spec.Extensions {
+			duration += extension.Duration.Duration
+		}
+		if duration > maxDuration {
+			return admission.Denied(fmt.Sprintf("AccessRequest %s/%s cannot be extended to grant access for longer than %s, the maximum duration of %s %s", accessRequest.Namespace, accessRequest.Name, maxDuration, roleRef.Kind, roleRef.Name))
+		}
+	}
+	return admission.Allowed("")
+}
+
+// approvals returns the approvals recorded for the accessrequest
+func approvals(accessRequest *iamv1alpha1.AccessRequest) []iamv1alpha1.Approval {
+	if accessRequest.Spec.Attributes == nil {
+		return nil
+	}
+	return accessRequest.Spec.Attributes.Approvals
+}
+
+// isFinished returns whether access granted by the accessrequest has been revoked or the
+// accessrequest was closed without granting access, for example because it was rejected
+func isFinished(accessRequest *iamv1alpha1.AccessRequest) bool {
+	for _, condition := range accessRequest.Status.Conditions {
+		if (condition.Type == iamv1alpha1.AccessRequestExpired || condition.Type == iamv1alpha1.AccessRequestRejected) && condition.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// withdrawalAllowed returns whether the requesting user is allowed to revoke or approve the
+// accessrequest
+func (v *AccessRequestValidator) withdrawalAllowed(ctx context.Context, req admission.Request, accessRequest *iamv1alpha1.AccessRequest) (bool, error) {
+	for _, verb := range []string{revokeVerb, approveVerb} {
+		sar, err := checkUserAccess(ctx, v.Client, req.UserInfo, verb, accessRequest, accessRequest.Namespace)
+		if err != nil {
+			return false, err
+		}
+		if sar.Status.Allowed && !sar.Status.Denied {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// validateApprovals verifies that the only change to the approvals of the accessrequest is the
+// requesting user approving it or approval being withdrawn. The mutating webhook ensures this
+func validateApprovals(req admission.Request, accessRequest, oldAccessRequest *iamv1alpha1.AccessRequest) error {
+	newApprovals, oldApprovals := approvals(accessRequest), approvals(oldAccessRequest)
+	if len(newApprovals) == 0 && oldAccessRequest.Spec.Approved && !accessRequest.Spec.Approved {
+		return nil
+	}
+	if len(newApprovals) != len(oldApprovals)+1 ||
+		!equality.Semantic.DeepEqual(newApprovals[:len(oldApprovals)], oldApprovals) ||
+		newApprovals[len(oldApprovals)].User != req.UserInfo.Username ||
+		!equality.Semantic.DeepEqual(newApprovals[len(oldApprovals)].UserInfo, iamv1alpha1.NewUserInfo(req.UserInfo)) {
+		return fmt.Errorf("spec.attributes.approvals of AccessRequest %s/%s can only be changed by approving it", accessRequest.Namespace, accessRequest.Name)
+	}
+	return nil
+}
+
+// roleFinding is a risky privilege granted by a role referenced by an accessrequest
+type roleFinding struct {
+	rules.Finding
+	roleRef rbacv1.RoleRef
+}
+
+// analyzeRoleRefs returns the risky privileges granted by the roles referenced by the accessrequest
+func (v *AccessRequestValidator) analyzeRoleRefs(ctx context.Context, log logr.Logger, accessRequest *iamv1alpha1.AccessRequest) []roleFinding {
+	findings := []roleFinding{}
+	for _, roleRef := range iamv1alpha1.RoleRefs(accessRequest) {
+		// The role granting the rules of the accessrequest does not exist until access is granted
+		if roleRef == iamv1alpha1.InlineRoleRef(accessRequest) {
+			for _, finding := range rules.Analyze(accessRequest.Spec.Rules) {
+				findings = append(findings, roleFinding{Finding: finding, roleRef: roleRef})
+			}
+			continue
+		}
+		_, policyRules, err := getRole(ctx, v.Client, accessRequest.Namespace, roleRef)
+		if err != nil {
+			// Warnings are advisory so failing to retrieve a role does not block admission
+			log.Error(err, "unable to get role", "kind", roleRef.Kind, "name", roleRef.Name)
+			continue
+		}
+		for _, finding := range rules.Analyze(policyRules) {
+			findings = append(findings, roleFinding{Finding: finding, roleRef: roleRef})
+		}
+	}
+	return findings
+}
+
+// auditAnnotations returns the annotations recorded in the API server audit log for the
+// accessrequest
+func auditAnnotations(req admission.Request, accessRequest *iamv1alpha1.AccessRequest, findings []roleFinding) map[string]string {
+	roleRefs := []string{}
+	for _, roleRef := range iamv1alpha1.RoleRefs(accessRequest) {
+		if roleRef == iamv1alpha1.InlineRoleRef(accessRequest) {
+			continue
+		}
+		roleRefs = append(roleRefs, fmt.Sprintf("%s/%s", roleRef.Kind, roleRef.Name))
+	}
+	annotations := map[string]string{
+		"role-ref": strings.Join(roleRefs, ","),
+	}
+	// The requester is the creator of the accessrequest rather than whoever is updating it
+	if accessRequest.Spec.Attributes != nil && accessRequest.Spec.Attributes.CreatedBy != "" {
+		annotations["requester"] = accessRequest.Spec.Attributes.CreatedBy
+	} else if req.Operation == admissionv1.Create {
+		annotations["requester"] = req.UserInfo.Username
+	}
+	if len(accessRequest.Spec.Rules) > 0 {
+		if data, err := json.Marshal(accessRequest.Spec.Rules); err == nil {
+			annotations["rules"] = string(data)
+		}
+	}
+	if accessRequest.Spec.Attributes != nil && accessRequest.Spec.Attributes.ApprovedBy != "" {
+		annotations["approver"] = accessRequest.Spec.Attributes.ApprovedBy
+	}
+	if len(findings) > 0 {
+		risks := []string{}
+		seen := map[rules.Risk]bool{}
+		for _, finding := range findings {
+			if !seen[finding.Risk] {
+				seen[finding.Risk] = true
+				risks = append(risks, string(finding.Risk))
+			}
+		}
+		annotations["risks"] = strings.Join(risks, ",")
+	}
+	return annotations
+}
+
+// describeRoleRef returns a description of the referenced role for warnings
+func describeRoleRef(accessRequest *iamv1alpha1.AccessRequest, roleRef rbacv1.RoleRef) string {
+	if roleRef == iamv1alpha1.InlineRoleRef(accessRequest) {
+		return "spec.rules"
+	}
+	return fmt.Sprintf("%s %s", roleRef.Kind, roleRef.Name)
+}
+
+// validateRules validates rules that are granted through a role created for the accessrequest
+func validateRules(policyRules []rbacv1.PolicyRule) error {
+	for i, rule := range policyRules {
+		if len(rule.Verbs) == 0 {
+			return fmt.Errorf("rule %d must set verbs", i)
+		}
+		// Non-resource URLs can only be granted by cluster roles
+		if len(rule.NonResourceURLs) > 0 {
+			return fmt.Errorf("rule %d sets nonResourceURLs which cannot be granted by a Role", i)
+		}
+		if len(rule.APIGroups) == 0 || len(rule.Resources) == 0 {
+			return fmt.Errorf("rule %d must set apiGroups and resources", i)
+		}
+	}
+	return nil
+}
+
+// InjectDecoder injects the decoder used to decode accessrequests
+func (v *AccessRequestValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+// validateDeletion protects active accessrequests from deletion by users who are not allowed to
+// revoke access. Who deleted the accessrequest is recorded in the audit log rather than on the
+// accessrequest so that the webhook has no side effects
+func (v *AccessRequestValidator) validateDeletion(ctx context.Context, log logr.Logger, req admission.Request) admission.Response {
+	accessRequest := &iamv1alpha1.AccessRequest{}
+	if err := v.decoder.DecodeRaw(req.OldObject, accessRequest); err != nil {
+		log.Error(err, "unable to decode AccessRequest")
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	active := isActive(accessRequest)
+	auditAnnotations := map[string]string{
+		"deleted-by": req.UserInfo.Username,
+		"active":     strconv.FormatBool(active),
+	}
+	if accessRequest.Spec.Attributes != nil {
+		auditAnnotations["created-by"] = accessRequest.Spec.Attributes.CreatedBy
+		if accessRequest.Spec.Attributes.ApprovedBy != "" {
+			auditAnnotations["approved-by"] = accessRequest.Spec.Attributes.ApprovedBy
+		}
+	}
+
+	// Deleting an active accessrequest revokes the access it grants. Retries of a deletion that
+	// has already been allowed are not checked again
+	if active && accessRequest.DeletionTimestamp == nil {
+		sar, err := checkUserAccess(ctx, v.Client, req.UserInfo, revokeVerb, accessRequest, accessRequest.Namespace)
+		if err != nil {
+			log.Error(err, "unable to check revoke access")
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+
+		if !sar.Status.Allowed || sar.Status.Denied {
+			response := admission.Denied(fmt.Sprintf("%s is not allowed to revoke active AccessRequest %s/%s", req.UserInfo.Username, accessRequest.Namespace, accessRequest.Name))
+			response.AuditAnnotations = auditAnnotations
+			return response
+		}
+	}
+
+	response := admission.Allowed("")
+	response.AuditAnnotations = auditAnnotations
+	return response
+}
+
+// validateRequestMetadata verifies that the accessrequest explains why access is required and
+// that its metadata can be recorded on the bindings created for it
+func (v *AccessRequestValidator) validateRequestMetadata(accessRequest *iamv1alpha1.AccessRequest) error {
+	if accessRequest.Spec.Reason == "" {
+		return fmt.Errorf("AccessRequest %s/%s must set spec.reason", accessRequest.Namespace, accessRequest.Name)
+	}
+
+	if v.TicketPattern != nil && !v.TicketPattern.MatchString(accessRequest.Spec.Ticket) {
+		return fmt.Errorf("AccessRequest %s/%s spec.ticket must match %s", accessRequest.Namespace, accessRequest.Name, v.TicketPattern)
+	}
+
+	for key := range accessRequest.Spec.Context {
+		if errs := validation.IsQualifiedName(iamv1alpha1.ContextAnnotationPrefix + key); len(errs) > 0 {
+			return fmt.Errorf("AccessRequest %s/%s spec.context key %q is invalid: %s", accessRequest.Namespace, accessRequest.Name, key, strings.Join(errs, ", "))
+		}
+	}
+
+	return nil
+}
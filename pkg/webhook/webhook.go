@@ -0,0 +1,195 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package webhook implements the admission webhooks for accessrequests so that they can be served
+// by the controller manager's webhook server or by the standalone webhook
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	iamv1alpha1 "github.com/dippynark/access-request-controller/api/v1alpha1"
+	"github.com/dippynark/access-request-controller/pkg/delegation"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	accessRequestResourcePlural = "accessrequests"
+	approveVerb                 = "approve"
+	breakGlassVerb              = "breakglass"
+	revokeVerb                  = "revoke"
+)
+
+var accessRequestResource = metav1.GroupVersionResource{
+	Group:    iamv1alpha1.GroupVersion.Group,
+	Version:  iamv1alpha1.GroupVersion.Version,
+	Resource: accessRequestResourcePlural,
+}
+
+// isActive returns whether the accessrequest grants access, or is about to, and has not expired.
+// Access is decided from the status as well as the spec because withdrawing approval does not
+// revoke access that has already been granted
+func isActive(accessRequest *iamv1alpha1.AccessRequest) bool {
+	if !isActivated(accessRequest) && !accessRequest.Spec.Approved && accessRequest.Spec.BreakGlass == nil {
+		return false
+	}
+	if !accessRequest.Status.ExpirationTime.IsZero() && !time.Now().Before(accessRequest.Status.ExpirationTime.Time) {
+		return false
+	}
+	for _, condition := range accessRequest.Status.Conditions {
+		if condition.Type == iamv1alpha1.AccessRequestExpired && condition.Status == corev1.ConditionTrue {
+			return false
+		}
+	}
+	return true
+}
+
+// isActivated returns whether the controller has granted access for the accessrequest
+func isActivated(accessRequest *iamv1alpha1.AccessRequest) bool {
+	if !accessRequest.Status.CompletionTime.IsZero() {
+		return true
+	}
+	for _, status := range accessRequest.Status.RoleBindings {
+		if status.Bound {
+			return true
+		}
+	}
+	return false
+}
+
+// getRole returns the metadata and rules of the role referenced from the given namespace
+func getRole(ctx context.Context, c client.Client, namespace string, roleRef rbacv1.RoleRef) (metav1.ObjectMeta, []rbacv1.PolicyRule, error) {
+	switch roleRef.Kind {
+	case "ClusterRole":
+		clusterRole := &rbacv1.ClusterRole{}
+		if err := c.Get(ctx, types.NamespacedName{Name: roleRef.Name}, clusterRole); err != nil {
+			return metav1.ObjectMeta{}, nil, err
+		}
+		return clusterRole.ObjectMeta, clusterRole.Rules, nil
+	case "Role":
+		role := &rbacv1.Role{}
+		if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: roleRef.Name}, role); err != nil {
+			return metav1.ObjectMeta{}, nil, err
+		}
+		return role.ObjectMeta, role.Rules, nil
+	default:
+		return metav1.ObjectMeta{}, nil, fmt.Errorf("unsupported role kind %q", roleRef.Kind)
+	}
+}
+
+// isPending returns whether the accessrequest has not yet been granted and may still be
+func isPending(accessRequest *iamv1alpha1.AccessRequest) bool {
+	for _, condition := range accessRequest.Status.Conditions {
+		if (condition.Type == iamv1alpha1.AccessRequestComplete || condition.Type == iamv1alpha1.AccessRequestExpired) && condition.Status == corev1.ConditionTrue {
+			return false
+		}
+	}
+	return accessRequest.DeletionTimestamp == nil
+}
+
+// approverAllowed returns whether the approval of the accessrequest is allowed in the given
+// namespace. Approvals made on behalf of a delegator require the delegator to have delegated their
+// approval rights to the user when the approval was made and to be allowed to approve the
+// accessrequest themselves
+func approverAllowed(ctx context.Context, c client.Client, accessRequest *iamv1alpha1.AccessRequest, approval iamv1alpha1.Approval, namespace string) (bool, error) {
+	if approval.Delegator != "" {
+		delegated, err := delegation.Delegated(ctx, c, approval.Delegator, approval.User, approval.Time.Time)
+		if err != nil || !delegated {
+			return false, err
+		}
+	}
+
+	// Approvers may be allowed to approve through their groups, for example those that
+	// accessrequests are escalated to
+	spec := iamv1alpha1.SubjectAccessReviewSpec(iamv1alpha1.Approver(approval), iamv1alpha1.ApproverUserInfo(approval))
+	sar, err := createSubjectAccessReview(ctx, c, spec, approveVerb, accessRequest, namespace)
+	if err != nil {
+		return false, err
+	}
+	return sar.Status.Allowed && !sar.Status.Denied, nil
+}
+
+// approverAllowedInNamespaces returns whether the approval of the accessrequest is allowed in every
+// given namespace
+func approverAllowedInNamespaces(ctx context.Context, c client.Client, accessRequest *iamv1alpha1.AccessRequest, approval iamv1alpha1.Approval, namespaces []string) (bool, error) {
+	for _, namespace := range namespaces {
+		allowed, err := approverAllowed(ctx, c, accessRequest, approval, namespace)
+		if err != nil || !allowed {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// checkUserAccess verifies whether the given user, including the groups they belong to, is allowed
+// the given verb on the accessrequest in the given namespace
+func checkUserAccess(ctx context.Context, c client.Client, userInfo authenticationv1.UserInfo, verb string, accessRequest *iamv1alpha1.AccessRequest, namespace string) (*authv1.SubjectAccessReview, error) {
+	extra := map[string]authv1.ExtraValue{}
+	for k, v := range userInfo.Extra {
+		extra[k] = authv1.ExtraValue(v)
+	}
+	spec := authv1.SubjectAccessReviewSpec{
+		User:   userInfo.Username,
+		Groups: userInfo.Groups,
+		Extra:  extra,
+		UID:    userInfo.UID,
+	}
+	return createSubjectAccessReview(ctx, c, spec, verb, accessRequest, namespace)
+}
+
+func createSubjectAccessReview(ctx context.Context, c client.Client, spec authv1.SubjectAccessReviewSpec, verb string, accessRequest *iamv1alpha1.AccessRequest, namespace string) (*authv1.SubjectAccessReview, error) {
+	spec.ResourceAttributes = &authv1.ResourceAttributes{
+		Name:      accessRequest.Name,
+		Namespace: namespace,
+		Verb:      verb,
+		Group:     iamv1alpha1.GroupVersion.Group,
+		Version:   iamv1alpha1.GroupVersion.Version,
+		Resource:  accessRequestResourcePlural,
+	}
+	sar := &authv1.SubjectAccessReview{Spec: spec}
+	if err := c.Create(ctx, sar); err != nil {
+		return nil, err
+	}
+	return sar, nil
+}
+
+// accessNamespaces returns the namespace of the accessrequest followed by the other existing
+// namespaces that it currently grants access in
+func accessNamespaces(ctx context.Context, c client.Client, accessRequest *iamv1alpha1.AccessRequest) ([]string, error) {
+	namespaceList := &corev1.NamespaceList{}
+	if err := c.List(ctx, namespaceList); err != nil {
+		return nil, err
+	}
+	targets, _, err := iamv1alpha1.TargetNamespaces(accessRequest, namespaceList.Items)
+	if err != nil {
+		return nil, err
+	}
+	namespaces := []string{accessRequest.Namespace}
+	for _, namespace := range targets {
+		if namespace != accessRequest.Namespace {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	return namespaces, nil
+}